@@ -10,8 +10,8 @@ import (
 
 // Echo 函数的入参
 type EchoIn struct {
-	Message  string    `json:"message"`
-	CreateAt time.Time `json:"create_at"`
+	Message  string       `json:"message"`
+	CreateAt sdk.JSONTime `json:"create_at"`
 }
 
 type Extention struct {
@@ -23,7 +23,7 @@ type Extention struct {
 type EchoOut struct {
 	Message    string       `json:"message"`
 	Extentions []*Extention `json:"extention"`
-	EchoAt     time.Time    `json:"echo_at"`
+	EchoAt     sdk.JSONTime `json:"echo_at"`
 }
 
 // Update Info函数不需要返回所有没有“Out”类的出参
@@ -42,7 +42,7 @@ type EchoServer struct {
 // 定义一个函数
 func (e *EchoServer) Echo(ctx context.Context, in *EchoIn, out *EchoOut) error {
 	out.Message = fmt.Sprintf("FYI: %s", in.Message)
-	out.EchoAt = time.Now()
+	out.EchoAt = sdk.JSONTime(time.Now())
 	return nil
 }
 
@@ -54,7 +54,11 @@ func (e *EchoServer) UpdateInfo(ctx context.Context, in *UpdateIn, out interface
 
 func main() {
 
-	svc, err := sdk.NewServiceWithDapr(":2000", sdk.GRPC, "demo.echo.hugelink.cn/v1", &EchoServer{})
+	svc, err := sdk.NewServer(
+		sdk.WithAddress(":2000"),
+		sdk.WithProtocol(sdk.GRPC),
+		sdk.WithReceiver("demo.echo.hugelink.cn/v1", &EchoServer{}),
+	)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,82 @@
+package dapr_sdk_warpper
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+//Permission 允许一个dapr服务调用函数组中的函数
+type Permission struct {
+	ServiceID string   `json:"service_id" yaml:"service_id"` //调用方的app-id
+	Method    []string `json:"method" yaml:"method"`         //允许调用的函数名，为空时允许调用函数组中的全部函数
+}
+
+//PermissionPolicy 按函数组的名称配置调用权限，可以通过LoadPermissionPolicy从YAML文件加载
+//
+//	demo.echo.hugelink.cn/v1:
+//	  - service_id: gateway
+//	    method: [echo]
+type PermissionPolicy map[string][]Permission
+
+//LoadPermissionPolicy 从YAML文件加载调用权限
+func LoadPermissionPolicy(path string) (PermissionPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := PermissionPolicy{}
+	if err = yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("permission %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+//函数的调用权限，在函数签名中列出
+type methodPermission struct {
+	Callers []string `yaml:"callers"` //允许调用的app-id
+}
+
+//按函数名汇总函数组的调用权限，没有配置权限时返回nil，表示不限制调用方
+func methodPermissions(methods map[string]*methodType, permissions []Permission) (map[string]*methodPermission, error) {
+	if len(permissions) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]*methodPermission, len(methods))
+	for name := range methods {
+		result[name] = &methodPermission{Callers: []string{}}
+	}
+	for _, p := range permissions {
+		if p.ServiceID == "" {
+			return nil, fmt.Errorf("permission with empty service_id")
+		}
+		names := p.Method
+		if len(names) == 0 {
+			for name := range methods {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			perm, ok := result[name]
+			if !ok {
+				return nil, fmt.Errorf("permission for unknown method %s", name)
+			}
+			perm.Callers = append(perm.Callers, p.ServiceID)
+		}
+	}
+	return result, nil
+}
+
+//调用方是否可以调用函数
+func (p *methodPermission) allow(caller string) bool {
+	if p == nil {
+		return true
+	}
+	for _, c := range p.Callers {
+		if c == caller && caller != "" {
+			return true
+		}
+	}
+	return false
+}
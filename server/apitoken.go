@@ -0,0 +1,47 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/dapr/go-sdk/service/common"
+)
+
+const (
+	//dapr调用应用时携带API token的metadata
+	apiTokenKey = "dapr-api-token"
+	//dapr配置给应用的API token，dapr调用应用时携带
+	appAPITokenEnv = "APP_API_TOKEN"
+	//应用调用dapr时使用的API token
+	daprAPITokenEnv = "DAPR_API_TOKEN"
+)
+
+//从文件读取token，忽略首尾的空白
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("token file " + path + " is empty")
+	}
+	return token, nil
+}
+
+//校验调用方携带的API token，token为空时不校验
+func withAPIToken(token string, handler common.ServiceInvocationHandler) common.ServiceInvocationHandler {
+	if token == "" {
+		return handler
+	}
+	return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+		got := incomingMetadata(ctx, apiTokenKey)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return nil, Unauthenticated("invalid dapr api token")
+		}
+		return handler(ctx, in)
+	}
+}
@@ -0,0 +1,201 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dapr/go-sdk/client"
+	"google.golang.org/grpc/metadata"
+)
+
+//Client 调用其他dapr服务的客户端，配置保存在实例中
+type Client struct {
+	dapr     client.Client
+	owned    bool //dapr客户端由NewClient创建，Close时关闭
+	logger   *log.Logger
+	codec    Codec
+	apiToken string
+}
+
+//dapr的gRPC端口
+const (
+	daprPortEnv     = "DAPR_GRPC_PORT"
+	daprPortDefault = "50001"
+)
+
+//ClientOption NewClient的配置项
+type ClientOption func(c *Client) error
+
+//WithDaprClient 使用指定的dapr客户端，默认使用dapr的默认客户端
+func WithDaprClient(dapr client.Client) ClientOption {
+	return func(c *Client) error {
+		if dapr == nil {
+			return errors.New("dapr client is null")
+		}
+		c.dapr = dapr
+		return nil
+	}
+}
+
+//WithClientLogger 设置客户端使用的Logger
+func WithClientLogger(logger *log.Logger) ClientOption {
+	return func(c *Client) error {
+		if logger == nil {
+			return errors.New("logger is null")
+		}
+		c.logger = logger
+		return nil
+	}
+}
+
+//WithClientCodec 设置请求与响应内容的编解码，默认为JSON
+//非JSON的编解码通过查询参数accept要求对方使用相同的编解码返回
+func WithClientCodec(codec Codec) ClientOption {
+	return func(c *Client) error {
+		if codec == nil {
+			return errors.New("codec is null")
+		}
+		c.codec = codec
+		return nil
+	}
+}
+
+//WithClientAPIToken 调用dapr时携带的API token，默认使用环境变量DAPR_API_TOKEN
+func WithClientAPIToken(token string) ClientOption {
+	return func(c *Client) error {
+		if token == "" {
+			return errors.New("api token is empty")
+		}
+		c.apiToken = token
+		return nil
+	}
+}
+
+//WithClientAPITokenFile 从文件读取调用dapr时携带的API token
+func WithClientAPITokenFile(path string) ClientOption {
+	return func(c *Client) error {
+		token, err := readTokenFile(path)
+		if err != nil {
+			return err
+		}
+		c.apiToken = token
+		return nil
+	}
+}
+
+//NewClient 创建调用其他dapr服务的客户端
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c := &Client{logger: getDefaultLogger(), codec: JSONCodec, apiToken: os.Getenv(daprAPITokenEnv)}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.dapr == nil {
+		//默认客户端由进程共享并且已经使用DAPR_API_TOKEN，其他token需要单独的客户端
+		if c.apiToken != "" && c.apiToken != os.Getenv(daprAPITokenEnv) {
+			dapr, err := newTokenClient(c.apiToken)
+			if err != nil {
+				return nil, err
+			}
+			c.dapr, c.owned = dapr, true
+		} else {
+			dapr, err := GetClient()
+			if err != nil {
+				return nil, err
+			}
+			c.dapr = dapr
+		}
+	}
+	return c, nil
+}
+
+//创建使用指定token的dapr客户端，不影响默认客户端
+func newTokenClient(token string) (client.Client, error) {
+	port := os.Getenv(daprPortEnv)
+	if port == "" {
+		port = daprPortDefault
+	}
+	dapr, err := client.NewClientWithPort(port)
+	if err != nil {
+		return nil, err
+	}
+	dapr.WithAuthToken(token)
+	return dapr, nil
+}
+
+//Close 关闭NewClient单独创建的dapr客户端，默认客户端与WithDaprClient指定的客户端不受影响
+func (c *Client) Close() {
+	if c.owned {
+		c.dapr.Close()
+	}
+}
+
+//GetClient 获取dapr的默认客户端
+func GetClient() (client.Client, error) {
+	return client.NewClient()
+}
+
+//Invoke 使用默认配置的客户端调用其他服务的函数
+func Invoke(appId, method string, in interface{}, out interface{}) error {
+	c, err := NewClient()
+	if err != nil {
+		return err
+	}
+	return c.Invoke(context.Background(), appId, method, in, out)
+}
+
+//Invoke 调用其他服务的函数
+//@Param method 函数的调用名称
+//@Param out 为nil时忽略返回内容
+//返回的错误为*Error，可以通过FromError获取错误码
+func (c *Client) Invoke(ctx context.Context, appId, method string, in interface{}, out interface{}) error {
+	data, err := c.codec.Marshal(in)
+	if err != nil {
+		return err
+	}
+	//dapr客户端自身设置了token时以其token为准
+	if c.apiToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, apiTokenKey, c.apiToken)
+	}
+	resp, err := c.dapr.InvokeMethodWithContent(ctx, appId, c.withQuery(ctx, method), "POST", &client.DataContent{
+		Data:        data,
+		ContentType: c.codec.ContentType(),
+	})
+	c.logger.Printf("invoke [%s.%s]\n in:`%s` out:`%s` error:%v", appId, method, string(data), string(resp), err)
+	if err != nil {
+		return FromError(err)
+	}
+	if out == nil || len(resp) == 0 {
+		return nil
+	}
+	if err = c.codec.Unmarshal(resp, out); err != nil {
+		return err
+	}
+	return nil
+}
+
+//dapr的客户端会覆盖metadata，通过查询参数传递调用的要求
+//非JSON的编解码要求对方使用相同的编解码返回，ctx有deadline时要求对方在剩余的时间内返回
+func (c *Client) withQuery(ctx context.Context, method string) string {
+	query := url.Values{}
+	if c.codec.ContentType() != JSONCodec.ContentType() {
+		query.Set(acceptKey, c.codec.ContentType())
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		query.Set(timeoutKey, time.Until(deadline).String())
+	}
+	if len(query) == 0 {
+		return method
+	}
+	sep := "?"
+	if strings.Contains(method, "?") {
+		sep = "&"
+	}
+	return method + sep + query.Encode()
+}
@@ -0,0 +1,170 @@
+package dapr_sdk_warpper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+//Codec 请求与响应内容的编解码
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+//内置的编解码，YAML与MessagePack同样使用json标签作为字段名
+var (
+	JSONCodec    Codec = jsonCodec{}
+	YAMLCodec    Codec = yamlCodec{}
+	MsgPackCodec Codec = msgpackCodec{}
+	ProtoCodec   Codec = protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+//YAML通过JSON中转，保证字段名与json标签一致
+type yamlCodec struct{}
+
+func (yamlCodec) ContentType() string {
+	return "application/yaml"
+}
+
+func (yamlCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err = json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(tree)
+}
+
+func (yamlCodec) Unmarshal(data []byte, v interface{}) error {
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+//protobuf只能用于实现了proto.Message的入参与出参
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+//CodecRegistry 按Content-Type查找编解码，每个服务与客户端独立持有
+type CodecRegistry struct {
+	sync.RWMutex
+	codecs map[string]Codec
+}
+
+//NewCodecRegistry 创建包含内置JSON、YAML、MessagePack与protobuf编解码的注册表
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{codecs: make(map[string]Codec)}
+	r.Register(JSONCodec, "text/json")
+	r.Register(YAMLCodec, "application/x-yaml", "text/yaml")
+	r.Register(MsgPackCodec, "application/x-msgpack")
+	r.Register(ProtoCodec, "application/protobuf")
+	return r
+}
+
+//Register 注册编解码，aliases为同样使用此编解码的其他Content-Type
+func (r *CodecRegistry) Register(codec Codec, aliases ...string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, contentType := range append([]string{codec.ContentType()}, aliases...) {
+		r.codecs[normalizeContentType(contentType)] = codec
+	}
+}
+
+//Lookup 按Content-Type查找编解码，忽略charset等参数
+func (r *CodecRegistry) Lookup(contentType string) (Codec, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	codec, ok := r.codecs[normalizeContentType(contentType)]
+	return codec, ok
+}
+
+//Negotiate 按Accept的顺序选择第一个已注册的编解码，没有匹配时返回def
+func (r *CodecRegistry) Negotiate(accept string, def Codec) Codec {
+	for _, contentType := range strings.Split(accept, ",") {
+		if codec, ok := r.Lookup(contentType); ok {
+			return codec
+		}
+	}
+	return def
+}
+
+func normalizeContentType(contentType string) string {
+	contentType = strings.TrimSpace(contentType)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(contentType)
+}
@@ -1,12 +1,38 @@
 package dapr_sdk_warpper
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+	dapr_http "github.com/dapr/go-sdk/service/http"
+	validator "github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,12 +58,6 @@ func TestHgMicro(t *testing.T) {
 	t.Logf("%v", reflect.TypeOf(&ctx).Elem().String())
 }
 
-type Permission struct {
-	//这里未来可以和调用权限管理挂起来
-	ServiceID string   `json:"service_id"`
-	Method    []string `json:"method"`
-}
-
 type SubDemo struct {
 	ID    int     `json:"id,omitempty"`
 	Float float64 `json:"float"`
@@ -110,3 +130,1414 @@ func TestNameFormat(t *testing.T) {
 	}
 	t.Logf("%s\n", string(data))
 }
+
+type AreaServer struct {
+}
+
+func (s *AreaServer) GetArea(ctx context.Context, in *AreaNode, out *AreaNode) error {
+	return nil
+}
+
+type UserServer struct {
+}
+
+func (s *UserServer) GetUser(ctx context.Context, in *SubDemo, out *YamlDemo) error {
+	return nil
+}
+
+func TestRegisterMultiReceiver(t *testing.T) {
+	server := newDaprServer()
+	if err := server.registMethods("area", &AreaServer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.registMethods("user", &UserServer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.registMethods("area", &UserServer{}); err == nil {
+		t.Fatal("duplicate receiver should be rejected")
+	}
+	sig, err := server.getSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig.Receivers) != 2 || sig.Receivers[0].APIVersion != "area" || sig.Receivers[1].APIVersion != "user" {
+		t.Fatalf("unexpected signature %+v", sig.Receivers)
+	}
+	if _, m := server.findMethod("get_user"); m == nil {
+		t.Fatal("get_user not found")
+	}
+	data, _ := server.getSignatureYaml()
+	t.Log(data)
+}
+
+func TestRoutePolicy(t *testing.T) {
+	p := RoutePolicy{UseClassName: true, Version: "v1"}
+	if r := p.Route("demo.echo.hugelink.cn", "echo"); r != "demo.echo.hugelink.cn/v1/echo" {
+		t.Fatalf("unexpected route %s", r)
+	}
+	if r := (RoutePolicy{}).Route("demo", "echo"); r != "echo" {
+		t.Fatalf("unexpected route %s", r)
+	}
+
+	server := newDaprServer()
+	if err := server.registReceiver(Receiver{ClassName: "a", Svr: &AreaServer{}, Route: RoutePolicy{UseClassName: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.registReceiver(Receiver{ClassName: "b", Svr: &AreaServer{}, Route: RoutePolicy{UseClassName: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.registReceiver(Receiver{ClassName: "c", Svr: &AreaServer{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.registReceiver(Receiver{ClassName: "d", Svr: &AreaServer{}}); err == nil {
+		t.Fatal("conflicting route should be rejected")
+	}
+	for _, route := range []string{"a/get_area", "b/get_area", "get_area"} {
+		if _, m := server.findMethod(route); m == nil {
+			t.Fatalf("%s not found", route)
+		}
+	}
+	if routes := server.signatureRoutes(); len(routes) != 3 {
+		t.Fatalf("unexpected signature routes %v", routes)
+	}
+}
+
+type LegacyServer struct {
+}
+
+func (s *LegacyServer) GetLoginKind(ctx context.Context, in *SubDemo, out *SubDemo) error {
+	return nil
+}
+
+func (s *LegacyServer) QueryArea(ctx context.Context, in *AreaNode, out *AreaNode) error {
+	return nil
+}
+
+func (s *LegacyServer) MethodAliases() map[string]string {
+	return map[string]string{"QueryArea": "get_area_list"}
+}
+
+func TestNamingStrategy(t *testing.T) {
+	cases := []struct {
+		naming   NamingStrategy
+		expected string
+	}{
+		{SnakeCase, "get_login_kind"},
+		{KebabCase, "get-login-kind"},
+		{LowerCamel, "getLoginKind"},
+		{Identity, "GetLoginKind"},
+	}
+	for _, c := range cases {
+		if name := c.naming.MethodName("GetLoginKind"); name != c.expected {
+			t.Fatalf("expected %s got %s", c.expected, name)
+		}
+	}
+
+	server := newDaprServer()
+	err := server.registReceiver(Receiver{
+		ClassName: "legacy",
+		Svr:       &LegacyServer{},
+		Naming:    LowerCamel,
+		Aliases:   map[string]string{"GetLoginKind": "login_kinds"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"login_kinds", "get_area_list"} {
+		if _, m := server.findMethod(route); m == nil {
+			t.Fatalf("%s not found", route)
+		}
+	}
+}
+
+type ShapeServer struct {
+}
+
+func (s *ShapeServer) Reply(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+	return &SubDemo{ID: in.ID + 1}, nil
+}
+
+func (s *ShapeServer) Update(ctx context.Context, in *SubDemo) error {
+	return nil
+}
+
+func (s *ShapeServer) List(ctx context.Context) (*AreaNode, error) {
+	return &AreaNode{Code: "0"}, nil
+}
+
+func (s *ShapeServer) Legacy(ctx context.Context, in *SubDemo, out interface{}) error {
+	return nil
+}
+
+func TestMethodShapes(t *testing.T) {
+	server := newDaprServer()
+	if err := server.registMethods("shape", &ShapeServer{}); err != nil {
+		t.Fatal(err)
+	}
+	_, m := server.findMethod("reply")
+	if m == nil {
+		t.Fatal("reply not found")
+	}
+	handler := server.invokeWarpper(m.route)
+	out, err := handler(context.Background(), &common.InvocationEvent{Data: []byte(`{"id":1}`), ContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Data) != `{"id":2,"float":0,"boolean":false}` {
+		t.Fatalf("unexpected reply %s", out.Data)
+	}
+
+	_, m = server.findMethod("list")
+	out, err = server.invokeWarpper(m.route)(context.Background(), &common.InvocationEvent{})
+	if err != nil || out == nil {
+		t.Fatalf("list failed %v", err)
+	}
+	for _, name := range []string{"update", "legacy"} {
+		_, m = server.findMethod(name)
+		out, err = server.invokeWarpper(m.route)(context.Background(), &common.InvocationEvent{Data: []byte(`{}`)})
+		if err != nil || out != nil {
+			t.Fatalf("%s should have no output: %v %v", name, out, err)
+		}
+	}
+
+	sig, err := server.getSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range sig.Receivers[0].Spec {
+		switch spec.Name {
+		case "list":
+			if !spec.NoInput || spec.NoOutput {
+				t.Fatalf("unexpected list signature %+v", spec)
+			}
+		case "update", "legacy":
+			if spec.NoInput || !spec.NoOutput {
+				t.Fatalf("unexpected %s signature %+v", spec.Name, spec)
+			}
+		}
+	}
+}
+
+func TestHandleFunc(t *testing.T) {
+	r := &Receiver{ClassName: "func", Route: RoutePolicy{UseClassName: true}}
+	Handle(r, "plus", func(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+		return &SubDemo{ID: in.ID + 1}, nil
+	})
+	server := newDaprServer()
+	if err := server.registReceiver(*r); err != nil {
+		t.Fatal(err)
+	}
+	_, m := server.findMethod("func/plus")
+	if m == nil {
+		t.Fatal("func/plus not found")
+	}
+	out, err := server.invokeWarpper(m.route)(context.Background(), &common.InvocationEvent{Data: []byte(`{"id":41}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Data) != `{"id":42,"float":0,"boolean":false}` {
+		t.Fatalf("unexpected reply %s", out.Data)
+	}
+	if sig := server.signature.Receivers[0].Spec[0]; sig.Name != "plus" || len(sig.In) != 3 {
+		t.Fatalf("unexpected signature %+v", sig)
+	}
+
+	bad := Receiver{ClassName: "bad", Strict: true}
+	Handle[SubDemo, SubDemo](&bad, "nil", nil)
+	Handle(&bad, "", func(ctx context.Context, in *SubDemo) (*SubDemo, error) { return in, nil })
+	var regErr *RegistrationError
+	if err := newDaprServer().registReceiver(bad); !errors.As(err, &regErr) || !regErr.HasReason(RejectNilFunc) || !regErr.HasReason(RejectEmptyName) {
+		t.Fatalf("nil function and empty name should be rejected got %v", err)
+	}
+}
+
+type BadServer struct {
+}
+
+func (s *BadServer) Good(ctx context.Context, in *SubDemo) error {
+	return nil
+}
+
+func (s *BadServer) NoContext(in *SubDemo, out *SubDemo) error {
+	return nil
+}
+
+func (s *BadServer) BadReturn(ctx context.Context, in *SubDemo) string {
+	return ""
+}
+
+func (s *BadServer) WithTime(ctx context.Context, in *GetLoginKindResponse) error {
+	return nil
+}
+
+func TestRegistrationError(t *testing.T) {
+	server := newDaprServer()
+	if err := server.registMethods("bad", &BadServer{}); err != nil {
+		t.Fatalf("non strict mode should skip bad methods: %v", err)
+	}
+	if _, m := server.findMethod("good"); m == nil {
+		t.Fatal("good not found")
+	}
+
+	server = newDaprServer()
+	err := server.registReceiver(Receiver{ClassName: "bad", Svr: &BadServer{}, Strict: true})
+	regErr, ok := err.(*RegistrationError)
+	if !ok {
+		t.Fatalf("expected RegistrationError got %v", err)
+	}
+	if len(regErr.Rejected) != 3 {
+		t.Fatalf("unexpected rejected methods %v", regErr.Rejected)
+	}
+	for _, reason := range []RejectReason{RejectContext, RejectBadReturn, RejectUnsupportedField} {
+		if !regErr.HasReason(reason) {
+			t.Fatalf("%s not reported: %v", reason, regErr)
+		}
+	}
+
+	//内置函数的调用名称不能被占用
+	for _, r := range []Receiver{
+		{ClassName: "builtin", Svr: &BuiltinServer{}, Strict: true},
+		{ClassName: "builtin", Svr: &BuiltinServer{}, Strict: true, Route: RoutePolicy{UseClassName: true}},
+	} {
+		err = newDaprServer().registReceiver(r)
+		if !errors.As(err, &regErr) || !regErr.HasReason(RejectReservedRoute) {
+			t.Fatalf("reserved route should be rejected got %v", err)
+		}
+	}
+	svc, _ := newTestServer(t, WithAdminMethods("ops"), WithAppAPIToken("secret"), WithReceiver("builtin", &BuiltinServer{}))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-caller-app-id", "ops", "dapr-api-token", "secret"))
+	out, err := svc.handlers[methodsMethod](ctx, &common.InvocationEvent{})
+	if err != nil || strings.Contains(string(out.Data), `"code"`) {
+		t.Fatalf("get_methods should stay the built-in handler: %s %v", out.Data, err)
+	}
+}
+
+type BuiltinServer struct {
+}
+
+func (s *BuiltinServer) GetMethods(ctx context.Context) (*AreaNode, error) {
+	return &AreaNode{Code: "0"}, nil
+}
+
+func (s *BuiltinServer) GetSignature(ctx context.Context) (*AreaNode, error) {
+	return &AreaNode{Code: "0"}, nil
+}
+
+func (s *BuiltinServer) Echo(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+	return in, nil
+}
+
+//用于测试的dapr服务，只记录注册的调用处理函数
+type fakeService struct {
+	common.Service
+	handlers map[string]common.ServiceInvocationHandler
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{handlers: map[string]common.ServiceInvocationHandler{}}
+}
+
+func (f *fakeService) AddServiceInvocationHandler(name string, fn common.ServiceInvocationHandler) error {
+	f.handlers[name] = fn
+	return nil
+}
+
+//测试服务的配置项，使用fakeService并且不输出日志，opts中的WithService与WithLogger优先
+func testServerOptions(opts ...Option) []Option {
+	return append([]Option{WithService(newFakeService()), WithLogger(log.New(io.Discard, "", 0))}, opts...)
+}
+
+//创建测试服务，创建失败时结束测试
+func newTestServer(t *testing.T, opts ...Option) (*fakeService, *Server) {
+	t.Helper()
+	server, err := NewServer(testServerOptions(opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := server.Service().(*fakeService)
+	return svc, server
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(WithAddress(":0"), WithProtocol(ServerType(9)), WithReceiver("area", &AreaServer{})); err == nil {
+		t.Fatal("invalid protocol should be rejected")
+	}
+	if _, err := NewServer(WithService(newFakeService())); err == nil {
+		t.Fatal("server without receiver should be rejected")
+	}
+
+	var called []string
+	middleware := func(name string) Middleware {
+		return func(next common.ServiceInvocationHandler) common.ServiceInvocationHandler {
+			return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+				called = append(called, name)
+				return next(ctx, in)
+			}
+		}
+	}
+	svc, _ := newTestServer(t,
+		WithMiddleware(middleware("outer"), middleware("inner")),
+		WithReceiver("area", &AreaServer{}),
+	)
+	if svc == nil {
+		t.Fatal("unexpected service")
+	}
+	if _, err := svc.handlers["get_area"](context.Background(), &common.InvocationEvent{Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(called) != 2 || called[0] != "outer" || called[1] != "inner" {
+		t.Fatalf("unexpected middleware order %v", called)
+	}
+	if _, ok := svc.handlers[signatureMethod]; !ok {
+		t.Fatal("get_signature not hooked")
+	}
+}
+
+type TagDemo struct {
+	Name string `json:"name" binding:"required" validate:"max=3"`
+}
+
+type TagServer struct {
+}
+
+func (s *TagServer) Check(ctx context.Context, in *TagDemo) error {
+	return nil
+}
+
+func TestServerIsolation(t *testing.T) {
+	var bufA, bufB bytes.Buffer
+	svcA, _ := newTestServer(t, WithLogger(log.New(&bufA, "", 0)), WithReceiver("tag", &TagServer{}))
+	svcB, _ := newTestServer(t, WithLogger(log.New(&bufB, "", 0)), WithValidatorTag("validate"), WithReceiver("tag", &TagServer{}))
+	//"binding"标签要求name必填，"validate"标签要求name不超过3个字符
+	if _, err := svcA.handlers["check"](context.Background(), &common.InvocationEvent{Data: []byte(`{"name":""}`)}); err == nil {
+		t.Fatal("server A should validate binding tag")
+	}
+	if _, err := svcB.handlers["check"](context.Background(), &common.InvocationEvent{Data: []byte(`{"name":""}`)}); err != nil {
+		t.Fatalf("server B should ignore binding tag: %v", err)
+	}
+	if _, err := svcB.handlers["check"](context.Background(), &common.InvocationEvent{Data: []byte(`{"name":"long"}`)}); err == nil {
+		t.Fatal("server B should validate validate tag")
+	}
+	//校验失败的调用不会执行函数
+	if strings.Contains(bufA.String(), "exec [check]") || strings.Count(bufB.String(), "exec [check]") != 1 {
+		t.Fatalf("unexpected logs\nA:%s\nB:%s", bufA.String(), bufB.String())
+	}
+}
+
+func TestMethodAdmin(t *testing.T) {
+	svc, server := newTestServer(t, WithAdminMethods("ops"), WithAppAPIToken("secret"), WithReceiver("shape", &ShapeServer{}))
+	reply := func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+		return svc.handlers["reply"](metadata.NewIncomingContext(ctx, metadata.Pairs("dapr-api-token", "secret")), in)
+	}
+	in := &common.InvocationEvent{Data: []byte(`{"id":1}`)}
+
+	if err := server.DisableMethod("reply"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reply(context.Background(), in); !errors.Is(err, ErrMethodDisabled) {
+		t.Fatalf("expected disabled error got %v", err)
+	}
+	if err := server.EnableMethod("reply"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reply(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.ReplaceMethod("reply", func(ctx context.Context, in *AreaNode) (*SubDemo, error) { return nil, nil }); err == nil {
+		t.Fatal("replacement with different input type should be rejected")
+	}
+	err := server.ReplaceMethod("reply", func(ctx context.Context, in *SubDemo, out *SubDemo) error {
+		out.ID = in.ID * 10
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := reply(context.Background(), in)
+	if err != nil || string(out.Data) != `{"id":10,"float":0,"boolean":false}` {
+		t.Fatalf("unexpected reply %v %v", out, err)
+	}
+	if err := server.DisableMethod("missing"); !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("expected not found error got %v", err)
+	}
+
+	//get_methods只允许WithAdminMethods中的调用方调用
+	admin := func(caller string) (*common.Content, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-caller-app-id", caller, "dapr-api-token", "secret"))
+		return svc.handlers[methodsMethod](ctx, &common.InvocationEvent{})
+	}
+	if _, err := admin("other"); FromError(err).Code != CodePermissionDenied {
+		t.Fatalf("expected permission denied got %v", err)
+	}
+	out, err = admin("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := []MethodState{}
+	if err := yaml.Unmarshal(out.Data, &states); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.Route == "reply" && !state.Replaced {
+			t.Fatalf("reply should be replaced: %+v", state)
+		}
+	}
+
+	//默认不开启get_methods，开启时需要校验dapr-api-token
+	svc, _ = newTestServer(t, WithReceiver("shape", &ShapeServer{}))
+	if _, ok := svc.handlers[methodsMethod]; ok {
+		t.Fatal("get_methods should be disabled by default")
+	}
+	if _, err := NewServer(testServerOptions(WithAdminMethods("ops"), WithReceiver("shape", &ShapeServer{}))...); err == nil {
+		t.Fatal("admin methods without app api token should be rejected")
+	}
+	if _, err := NewServer(testServerOptions(WithAdminMethods(), WithAppAPIToken("secret"), WithReceiver("shape", &ShapeServer{}))...); err == nil {
+		t.Fatal("admin methods without callers should be rejected")
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	svc, _ := newTestServer(t, WithReceiver("shape", &ShapeServer{}))
+	reply := svc.handlers["reply"]
+
+	//YAML请求，默认JSON响应
+	out, err := reply(context.Background(), &common.InvocationEvent{Data: []byte("id: 1\n"), ContentType: "application/yaml; charset=utf-8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ContentType != "application/json" || string(out.Data) != `{"id":2,"float":0,"boolean":false}` {
+		t.Fatalf("unexpected reply %s %s", out.ContentType, out.Data)
+	}
+
+	//JSON请求，按accept返回MessagePack
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept", "text/html, application/msgpack"))
+	out, err = reply(ctx, &common.InvocationEvent{Data: []byte(`{"id":1}`), ContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &SubDemo{}
+	if out.ContentType != "application/msgpack" {
+		t.Fatalf("unexpected content type %s", out.ContentType)
+	}
+	if err := MsgPackCodec.Unmarshal(out.Data, result); err != nil || result.ID != 2 {
+		t.Fatalf("unexpected reply %+v %v", result, err)
+	}
+
+	//查询参数中的accept优先
+	out, err = reply(ctx, &common.InvocationEvent{Data: []byte(`{"id":1}`), QueryString: "accept=application%2Fyaml"})
+	if err != nil || out.ContentType != "application/yaml" {
+		t.Fatalf("unexpected reply %v %v", out, err)
+	}
+}
+
+//用于测试的dapr客户端，直接调用fakeService中的处理函数
+type fakeClient struct {
+	client.Client
+	svc       *fakeService
+	authToken string //WithAuthToken设置的token
+	token     string //最近一次调用携带的token
+}
+
+func (f *fakeClient) WithAuthToken(token string) {
+	f.authToken = token
+}
+
+func (f *fakeClient) InvokeMethodWithContent(ctx context.Context, appID, methodName, verb string, content *client.DataContent) ([]byte, error) {
+	f.token = ""
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(apiTokenKey)) > 0 {
+		f.token = md.Get(apiTokenKey)[0]
+	}
+	method, query := methodName, ""
+	if idx := strings.Index(methodName, "?"); idx > 0 {
+		method, query = methodName[:idx], methodName[idx+1:]
+	}
+	out, err := f.svc.handlers[method](ctx, &common.InvocationEvent{Data: content.Data, ContentType: content.ContentType, QueryString: query})
+	if err != nil || out == nil {
+		return nil, err
+	}
+	return out.Data, nil
+}
+
+func TestClientCodec(t *testing.T) {
+	svc, _ := newTestServer(t, WithReceiver("shape", &ShapeServer{}))
+	for _, codec := range []Codec{JSONCodec, YAMLCodec, MsgPackCodec} {
+		c, err := NewClient(WithDaprClient(&fakeClient{svc: svc}), WithClientLogger(log.New(io.Discard, "", 0)), WithClientCodec(codec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &SubDemo{}
+		if err := c.Invoke(context.Background(), "app", "reply", &SubDemo{ID: 1}, out); err != nil || out.ID != 2 {
+			t.Fatalf("%s: unexpected reply %+v %v", codec.ContentType(), out, err)
+		}
+	}
+}
+
+type ErrorServer struct {
+}
+
+func (s *ErrorServer) Find(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+	return nil, NotFound("demo %d not found", in.ID).WithDetail("id", "1")
+}
+
+func (s *ErrorServer) Fail(ctx context.Context, in *SubDemo) error {
+	return errors.New("disk 100% full")
+}
+
+func TestErrorModel(t *testing.T) {
+	svc, _ := newTestServer(t, WithReceiver("error", &ErrorServer{}), WithReceiver("tag", &TagServer{}))
+	//gRPC服务直接使用Error的状态码
+	_, err := svc.handlers["find"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":1}`)})
+	st, _ := status.FromError(err)
+	if st.Code() != codes.NotFound {
+		t.Fatalf("unexpected status %v", st)
+	}
+	if e := FromError(st.Err()); e.Code != CodeNotFound || e.Details["id"] != "1" || e.Message != "demo 1 not found" {
+		t.Fatalf("unexpected decoded error %+v", e)
+	}
+	_, err = svc.handlers["check"](context.Background(), &common.InvocationEvent{Data: []byte(`{}`)})
+	if FromError(err).Code != CodeInvalidArgument {
+		t.Fatalf("validation error should be invalid argument: %v", err)
+	}
+	_, err = svc.handlers["fail"](context.Background(), &common.InvocationEvent{Data: []byte(`{}`)})
+	if e := FromError(err); e.Code != CodeUnknown || e.Message != "disk 100% full" {
+		t.Fatalf("plain error should be unknown with its message kept: %v", err)
+	}
+
+	//HTTP服务输出对应的状态码与JSON内容
+	router := NewHTTPRouter()
+	newTestServer(t, WithService(dapr_http.NewServiceWithMux(":0", router)), WithReceiver("error", &ErrorServer{}))
+	req := httptest.NewRequest(http.MethodPost, "/find", strings.NewReader(`{"id":1}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected http status %d %s", rec.Code, rec.Body.String())
+	}
+	e := FromError(status.Error(codes.Unknown, rec.Body.String()))
+	if e.Code != CodeNotFound || e.Details["id"] != "1" {
+		t.Fatalf("unexpected http error body %s", rec.Body.String())
+	}
+}
+
+type PanicServer struct {
+}
+
+func (s *PanicServer) Boom(ctx context.Context, in *SubDemo) error {
+	panic("boom")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	svc, server := newTestServer(t, WithReceiver("panic", &PanicServer{}))
+	in := &common.InvocationEvent{Data: []byte(`{"id":1}`)}
+	_, err := svc.handlers["boom"](context.Background(), in)
+	if e := FromError(err); e == nil || e.Code != CodeInternal {
+		t.Fatalf("expected internal error got %v", err)
+	}
+	for _, state := range server.MethodStates() {
+		if state.Route == "boom" && (state.Stats.Calls != 1 || state.Stats.Errors != 1 || state.Stats.Panics != 1) {
+			t.Fatalf("unexpected stats %+v", state.Stats)
+		}
+	}
+
+	svc, _ = newTestServer(t, WithDevelopment(true), WithRepanic(true), WithReceiver("panic", &PanicServer{}))
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected panic to be re-raised got %v", r)
+		}
+	}()
+	svc.handlers["boom"](context.Background(), in)
+}
+
+func TestInterceptor(t *testing.T) {
+	var order []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, info *MethodInfo, in interface{}, next InvokeFunc) (interface{}, error) {
+			order = append(order, name+":"+info.Method)
+			return next(ctx, in)
+		}
+	}
+	double := func(ctx context.Context, info *MethodInfo, in interface{}, next InvokeFunc) (interface{}, error) {
+		if info.ArgType != reflect.TypeOf(&SubDemo{}) || info.ReplyType != reflect.TypeOf(&SubDemo{}) {
+			t.Fatalf("unexpected method info %+v", info)
+		}
+		in.(*SubDemo).ID *= 2
+		return next(ctx, in)
+	}
+	deny := func(ctx context.Context, info *MethodInfo, in interface{}, next InvokeFunc) (interface{}, error) {
+		return nil, PermissionDenied("denied")
+	}
+	drop := func(ctx context.Context, info *MethodInfo, in interface{}, next InvokeFunc) (interface{}, error) {
+		return next(ctx, nil)
+	}
+	svc, server := newTestServer(t, WithInterceptor(record("first"), record("second")),
+		WithReceivers(Receiver{
+			ClassName:    "shape",
+			Svr:          &ShapeServer{},
+			Interceptors: map[string][]Interceptor{"reply": {record("method"), double}, "update": {deny}, "legacy": {drop}},
+		}))
+	out, err := svc.handlers["reply"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":1}`)})
+	if err != nil || string(out.Data) != `{"id":3,"float":0,"boolean":false}` {
+		t.Fatalf("unexpected reply %v %v", out, err)
+	}
+	if strings.Join(order, ",") != "first:Reply,second:Reply,method:Reply" {
+		t.Fatalf("unexpected order %v", order)
+	}
+	if _, err := svc.handlers["update"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":1}`)}); FromError(err).Code != CodePermissionDenied {
+		t.Fatalf("expected permission denied got %v", err)
+	}
+	//拦截器传递nil作为入参时返回内部错误，不作为panic处理
+	_, err = svc.handlers["legacy"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":1}`)})
+	if e := FromError(err); e.Code != CodeInternal || !strings.Contains(e.Message, "interceptor passed <nil> as input") {
+		t.Fatalf("expected interceptor input error got %v", err)
+	}
+	for _, state := range server.MethodStates() {
+		if state.Route == "legacy" && state.Stats.Panics != 0 {
+			t.Fatalf("unexpected stats %+v", state.Stats)
+		}
+	}
+
+	_, err = NewServer(testServerOptions(
+		WithReceivers(Receiver{ClassName: "shape", Svr: &ShapeServer{}, Interceptors: map[string][]Interceptor{"missing": {deny}}}))...)
+	if err == nil {
+		t.Fatal("interceptors for unknown method should be rejected")
+	}
+}
+
+func TestInvocationInfo(t *testing.T) {
+	var got *InvocationInfo
+	r := Receiver{ClassName: "info"}
+	Handle(&r, "inspect", func(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+		got, _ = FromContext(ctx)
+		return in, nil
+	})
+	svc, _ := newTestServer(t, WithReceivers(r))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-caller-app-id", "caller", "traceparent", "00-abc-def-01"))
+	in := &common.InvocationEvent{Data: []byte(`{"id":1}`), Verb: "POST", QueryString: "a=1&a=2", ContentType: "application/json"}
+	if _, err := svc.handlers["inspect"](ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Method != "inspect" || got.Verb != "POST" || got.CallerAppID != "caller" ||
+		len(got.Query["a"]) != 2 || got.Trace["traceparent"] != "00-abc-def-01" || string(got.Data) != `{"id":1}` {
+		t.Fatalf("unexpected invocation info %+v", got)
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("context without invocation should have no info")
+	}
+}
+
+type SlowServer struct {
+}
+
+func (s *SlowServer) Sleep(ctx context.Context, in *SubDemo) error {
+	time.Sleep(time.Duration(in.ID) * time.Millisecond)
+	return nil
+}
+
+func (s *SlowServer) Patient(ctx context.Context, in *SubDemo) error {
+	time.Sleep(time.Duration(in.ID) * time.Millisecond)
+	return nil
+}
+
+func (s *SlowServer) MethodTimeouts() map[string]time.Duration {
+	return map[string]time.Duration{"Patient": time.Second}
+}
+
+func TestTimeout(t *testing.T) {
+	svc, server := newTestServer(t, WithTimeout(20*time.Millisecond), WithReceiver("slow", &SlowServer{}))
+	slow := &common.InvocationEvent{Data: []byte(`{"id":200}`)}
+	start := time.Now()
+	_, err := svc.handlers["sleep"](context.Background(), slow)
+	if e := FromError(err); e == nil || e.Code != CodeDeadlineExceeded {
+		t.Fatalf("expected deadline exceeded got %v", err)
+	}
+	if time.Since(start) > 150*time.Millisecond {
+		t.Fatal("timeout should not wait for the method")
+	}
+	if _, err := svc.handlers["patient"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":50}`)}); err != nil {
+		t.Fatalf("per-method timeout should override the default: %v", err)
+	}
+	//调用方要求的超时时间更短时生效
+	_, err = svc.handlers["patient"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":200}`), QueryString: "timeout=10ms"})
+	if e := FromError(err); e == nil || e.Code != CodeDeadlineExceeded {
+		t.Fatalf("expected caller deadline to be honored got %v", err)
+	}
+	for _, state := range server.MethodStates() {
+		if state.Route == "sleep" && state.Stats.Timeouts != 1 {
+			t.Fatalf("unexpected stats %+v", state.Stats)
+		}
+	}
+
+	_, err = NewServer(testServerOptions(WithMethodTimeout("missing", time.Second), WithReceiver("slow", &SlowServer{}))...)
+	if !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("timeout for unknown method should be rejected got %v", err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	started, unblock := make(chan struct{}, 2), make(chan struct{})
+	r := Receiver{ClassName: "limit"}
+	Handle(&r, "export", func(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+		started <- struct{}{}
+		<-unblock
+		return in, nil
+	})
+	svc, server := newTestServer(t, WithReceivers(r),
+		WithMethodConcurrency("export", ConcurrencyLimit{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 20 * time.Millisecond}))
+	export := svc.handlers["export"]
+	in := &common.InvocationEvent{Data: []byte(`{"id":1}`)}
+	done := make(chan error)
+	go func() {
+		_, err := export(context.Background(), in)
+		done <- err
+	}()
+	<-started
+
+	//第二个调用在队列中等待超时，第三个调用因为队列已满直接被拒绝
+	queued := make(chan error)
+	go func() {
+		_, err := export(context.Background(), in)
+		queued <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := export(context.Background(), in); FromError(err).Code != CodeResourceExhausted {
+		t.Fatalf("expected resource exhausted got %v", err)
+	}
+	if err := <-queued; FromError(err).Code != CodeResourceExhausted {
+		t.Fatalf("expected queue timeout got %v", err)
+	}
+	stats := server.MethodStates()[0].Stats
+	if stats.InFlight != 1 || stats.Rejected != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := export(context.Background(), in); err != nil {
+		t.Fatalf("call should be accepted after release: %v", err)
+	}
+	if stats := server.MethodStates()[0].Stats; stats.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+//在内存中模拟dapr的状态存储
+type fakeStateClient struct {
+	client.Client
+	sync.Mutex
+	state   map[string]*client.StateItem
+	version int
+	err     error  //SaveBulkState返回的错误
+	missing func() //读取到不存在的键之后调用，模拟其他副本同时创建
+}
+
+func (f *fakeStateClient) GetState(ctx context.Context, storeName, key string) (*client.StateItem, error) {
+	f.Lock()
+	item, ok := f.state[key]
+	f.Unlock()
+	if ok {
+		return item, nil
+	}
+	if f.missing != nil {
+		f.missing()
+	}
+	return &client.StateItem{Key: key}, nil
+}
+
+//与dapr的first-write一致：不携带ETag时只能创建，ETag不一致时返回Aborted
+func (f *fakeStateClient) SaveBulkState(ctx context.Context, storeName string, items ...*client.SetStateItem) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for _, item := range items {
+		old, ok := f.state[item.Key]
+		if (ok && (item.Etag == nil || item.Etag.Value != old.Etag)) || (!ok && item.Etag != nil) {
+			return status.Error(codes.Aborted, "possible etag mismatch")
+		}
+		f.version++
+		f.state[item.Key] = &client.StateItem{Key: item.Key, Value: item.Value, Etag: fmt.Sprint(f.version)}
+	}
+	return nil
+}
+
+func TestRateLimit(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	err := os.WriteFile(policy, []byte(`
+limits:
+  - rate: 1
+    burst: 2
+  - caller: trusted
+    rate: 100
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(svc *fakeService, caller string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-caller-app-id", caller, "dapr-api-token", "secret"))
+		_, err := svc.handlers["reply"](ctx, &common.InvocationEvent{Data: []byte(`{"id":1}`)})
+		return err
+	}
+	svc, server := newTestServer(t, WithRateLimitFile(policy), WithAppAPIToken("secret"), WithReceiver("shape", &ShapeServer{}))
+	for i := 0; i < 2; i++ {
+		if err := call(svc, "noisy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := call(svc, "noisy"); FromError(err).Code != CodeResourceExhausted {
+		t.Fatalf("expected rate limit got %v", err)
+	}
+	//其他调用方不受影响
+	for i := 0; i < 3; i++ {
+		if err := call(svc, "trusted"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := call(svc, "quiet"); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range server.MethodStates() {
+		if state.Route == "reply" && state.Stats.RateLimited != 1 {
+			t.Fatalf("unexpected stats %+v", state.Stats)
+		}
+	}
+
+	//保存在状态存储中的令牌桶由多个副本共享
+	store := &fakeStateClient{state: map[string]*client.StateItem{}}
+	config := RateLimitConfig{Store: "statestore", Client: store, Limits: []RateLimit{{Method: "reply", Rate: 1, Burst: 1}}}
+	replicas := make([]*fakeService, 2)
+	for i := range replicas {
+		replicas[i], _ = newTestServer(t, WithRateLimit(config), WithAppAPIToken("secret"), WithReceiver("shape", &ShapeServer{}))
+	}
+	if err := call(replicas[0], "noisy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(replicas[1], "noisy"); FromError(err).Code != CodeResourceExhausted {
+		t.Fatalf("expected shared rate limit got %v", err)
+	}
+
+	//其他副本同时创建令牌桶时，以其创建的令牌桶为准
+	limit := RateLimit{Rate: 1, Burst: 1}
+	store = &fakeStateClient{state: map[string]*client.StateItem{}}
+	other := &stateBuckets{dapr: store, store: "statestore"}
+	store.missing = func() {
+		store.missing = nil
+		if allowed, err := other.take(context.Background(), "k", limit); err != nil || !allowed {
+			t.Errorf("other replica should take the token: %v %v", allowed, err)
+		}
+	}
+	if allowed, err := (&stateBuckets{dapr: store, store: "statestore"}).take(context.Background(), "k", limit); err != nil || allowed {
+		t.Fatalf("token should be taken by the other replica: %v %v", allowed, err)
+	}
+	//状态存储的其他错误原样返回
+	store.err = errors.New("store is down")
+	if _, err := other.take(context.Background(), "k", limit); !errors.Is(err, store.err) {
+		t.Fatalf("expected store error got %v", err)
+	}
+
+	_, err = NewServer(testServerOptions(WithAppAPIToken("secret"),
+		WithRateLimit(RateLimitConfig{Limits: []RateLimit{{Method: "replay", Rate: 1}}}), WithReceiver("shape", &ShapeServer{}))...)
+	if err == nil {
+		t.Fatal("rate limit for unknown method should be rejected")
+	}
+
+	//没有dapr-api-token校验时调用方可以伪造app-id绕过令牌桶，拒绝配置限流
+	_, err = NewServer(testServerOptions(WithRateLimitFile(policy), WithReceiver("shape", &ShapeServer{}))...)
+	if err == nil {
+		t.Fatal("rate limits without app api token should be rejected")
+	}
+}
+
+func TestPermission(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "permission.yaml")
+	err := os.WriteFile(policy, []byte(`
+shape:
+  - service_id: gateway
+    method: [reply]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := newTestServer(t, WithPermissionFile(policy), WithAppAPIToken("secret"),
+		WithReceivers(Receiver{ClassName: "shape", Svr: &ShapeServer{}, Permissions: []Permission{{ServiceID: "admin"}}}))
+	call := func(route, caller string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-caller-app-id", caller, "dapr-api-token", "secret"))
+		_, err := svc.handlers[route](ctx, &common.InvocationEvent{Data: []byte(`{"id":1}`)})
+		return err
+	}
+	for _, c := range []struct {
+		route, caller string
+		allowed       bool
+	}{
+		{"reply", "gateway", true},
+		{"reply", "admin", true},
+		{"update", "admin", true},
+		{"update", "gateway", false},
+		{"reply", "other", false},
+		{"reply", "", false},
+	} {
+		err := call(c.route, c.caller)
+		if c.allowed && err != nil || !c.allowed && FromError(err).Code != CodePermissionDenied {
+			t.Fatalf("%s by %q: unexpected result %v", c.route, c.caller, err)
+		}
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-api-token", "secret"))
+	out, err := svc.handlers[signatureMethod](ctx, &common.InvocationEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &serviceSignature{}
+	if err := yaml.Unmarshal(out.Data, sig); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range sig.Receivers[0].Spec {
+		if spec.Name == "reply" && (spec.Permission == nil || strings.Join(spec.Permission.Callers, ",") != "admin,gateway") {
+			t.Fatalf("unexpected permission in signature %+v", spec.Permission)
+		}
+	}
+
+	_, err = NewServer(testServerOptions(WithAppAPIToken("secret"),
+		WithReceivers(Receiver{ClassName: "shape", Svr: &ShapeServer{}, Permissions: []Permission{{ServiceID: "admin", Method: []string{"missing"}}}}))...)
+	if err == nil {
+		t.Fatal("permission for unknown method should be rejected")
+	}
+
+	//没有dapr-api-token校验时调用方的app-id可以伪造，拒绝配置权限
+	_, err = NewServer(testServerOptions(WithPermissionFile(policy), WithReceiver("shape", &ShapeServer{}))...)
+	if err == nil {
+		t.Fatal("permissions without app api token should be rejected")
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	token := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := newTestServer(t, WithAppAPITokenFile(token), WithReceiver("shape", &ShapeServer{}))
+	in := &common.InvocationEvent{Data: []byte(`{"id":1}`)}
+	for _, route := range []string{"reply", signatureMethod} {
+		if _, err := svc.handlers[route](context.Background(), in); FromError(err).Code != CodeUnauthenticated {
+			t.Fatalf("%s: expected unauthenticated got %v", route, err)
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-api-token", "wrong"))
+		if _, err := svc.handlers[route](ctx, in); FromError(err).Code != CodeUnauthenticated {
+			t.Fatalf("%s: expected unauthenticated got %v", route, err)
+		}
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("dapr-api-token", "secret"))
+		if _, err := svc.handlers[route](ctx, in); err != nil {
+			t.Fatalf("%s: %v", route, err)
+		}
+	}
+
+	//普通mux创建的HTTP服务读取不到请求头，拒绝依赖请求头的配置
+	_, err := NewServer(testServerOptions(WithService(dapr_http.NewServiceWithMux(":0", mux.NewRouter())), WithAppAPIToken("secret"), WithReceiver("shape", &ShapeServer{}))...)
+	if err == nil {
+		t.Fatal("expected error for http service without header support")
+	}
+	_, server := newTestServer(t, WithService(NewHTTPService(":0")), WithAppAPIToken("secret"), WithReceiver("shape", &ShapeServer{}))
+	router := server.Service().(*httpService).router
+	for _, c := range []struct {
+		token string
+		code  int
+	}{{"", http.StatusUnauthorized}, {"secret", http.StatusOK}} {
+		req := httptest.NewRequest(http.MethodPost, "/reply", strings.NewReader(`{"id":1}`))
+		req.Header.Set("dapr-api-token", c.token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Fatalf("token %q: unexpected http status %d %s", c.token, rec.Code, rec.Body.String())
+		}
+	}
+
+	//token随每次调用携带，不修改共享的dapr客户端
+	t.Setenv("DAPR_API_TOKEN", "client-secret")
+	svc, _ = newTestServer(t, WithReceiver("shape", &ShapeServer{}))
+	dapr := &fakeClient{svc: svc}
+	byEnv, err := NewClient(WithDaprClient(dapr), WithClientLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byOption, err := NewClient(WithDaprClient(dapr), WithClientLogger(log.New(io.Discard, "", 0)), WithClientAPIToken("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		client *Client
+		token  string
+	}{{byEnv, "client-secret"}, {byOption, "other-secret"}, {byEnv, "client-secret"}} {
+		if err := c.client.Invoke(context.Background(), "app", "update", &SubDemo{ID: 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if dapr.token != c.token {
+			t.Fatalf("expected token %q got %q", c.token, dapr.token)
+		}
+	}
+	if dapr.authToken != "" {
+		t.Fatalf("shared dapr client should not be changed got %q", dapr.authToken)
+	}
+}
+
+//生成测试用的JWT
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims Claims) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hashed[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kid": "rsa1",
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := []byte("hmac-secret")
+
+	var got Claims
+	r := Receiver{ClassName: "jwt", Auth: map[string]AuthRequirement{"admin": {Scopes: []string{"write"}, Roles: []string{"admin", "ops"}}}}
+	Handle(&r, "admin", func(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+		got, _ = ClaimsFromContext(ctx)
+		return in, nil
+	})
+	Handle(&r, "public", func(ctx context.Context, in *SubDemo) (*SubDemo, error) {
+		return in, nil
+	})
+	svc, _ := newTestServer(t, WithReceivers(r),
+		WithJWT(JWTConfig{Issuer: "gateway", Audience: "orders", HMACKey: hmacKey, JWKSFile: jwksFile}))
+	call := func(route, token string) error {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+		_, err := svc.handlers[route](ctx, &common.InvocationEvent{Data: []byte(`{"id":1}`)})
+		return err
+	}
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	valid := Claims{"sub": "u1", "iss": "gateway", "aud": []string{"orders"}, "exp": exp, "scope": "read write", "roles": []string{"ops"}}
+	for _, c := range []struct {
+		name  string
+		route string
+		token string
+		code  Code
+	}{
+		{"rs256", "admin", signJWT(t, "RS256", "rsa1", rsaKey, valid), ""},
+		{"hs256", "admin", signJWT(t, "HS256", "", hmacKey, valid), ""},
+		{"missing token", "admin", "", CodeUnauthenticated},
+		{"public without token", "public", "", ""},
+		{"wrong key", "admin", signJWT(t, "HS256", "", []byte("other"), valid), CodeUnauthenticated},
+		{"expired", "admin", signJWT(t, "HS256", "", hmacKey, Claims{"iss": "gateway", "aud": "orders", "exp": float64(time.Now().Add(-time.Hour).Unix())}), CodeUnauthenticated},
+		{"wrong audience", "admin", signJWT(t, "HS256", "", hmacKey, Claims{"iss": "gateway", "aud": "billing", "exp": exp}), CodeUnauthenticated},
+		{"missing scope", "admin", signJWT(t, "HS256", "", hmacKey, Claims{"iss": "gateway", "aud": "orders", "exp": exp, "scope": "read", "roles": []string{"ops"}}), CodePermissionDenied},
+		{"missing role", "admin", signJWT(t, "HS256", "", hmacKey, Claims{"iss": "gateway", "aud": "orders", "exp": exp, "scope": "write"}), CodePermissionDenied},
+	} {
+		err := call(c.route, c.token)
+		if c.code == "" && err != nil || c.code != "" && FromError(err).Code != c.code {
+			t.Fatalf("%s: unexpected result %v", c.name, err)
+		}
+	}
+	if got.Subject() != "u1" {
+		t.Fatalf("unexpected claims %v", got)
+	}
+
+	out, err := svc.handlers[signatureMethod](context.Background(), &common.InvocationEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out.Data), "scopes:\n") {
+		t.Fatalf("signature should list auth requirements\n%s", out.Data)
+	}
+}
+
+type ValidDemo struct {
+	Name string `json:"name" binding:"required"`
+	Sub  struct {
+		Age int `json:"age" binding:"max=3"`
+	} `json:"sub"`
+}
+
+type ValidServer struct {
+}
+
+func (s *ValidServer) Check(ctx context.Context, in *ValidDemo) error {
+	return nil
+}
+
+func TestValidationError(t *testing.T) {
+	svc, _ := newTestServer(t, WithReceiver("valid", &ValidServer{}))
+	in := &common.InvocationEvent{Data: []byte(`{"name":"","sub":{"age":5}}`)}
+	_, err := svc.handlers["check"](context.Background(), in)
+	e := FromError(err)
+	if e.Code != CodeInvalidArgument || len(e.Fields) != 2 {
+		t.Fatalf("unexpected error %+v", e)
+	}
+	if f := e.Fields[0]; f.Field != "name" || f.Rule != "required" || f.Message != "name is a required field" {
+		t.Fatalf("unexpected field error %+v", f)
+	}
+	if f := e.Fields[1]; f.Field != "sub.age" || f.Rule != "max" || f.Param != "3" {
+		t.Fatalf("unexpected field error %+v", f)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "zh-CN,zh;q=0.9"))
+	_, err = svc.handlers["check"](ctx, in)
+	if e := FromError(err); e.Fields[0].Message != "name为必填字段" {
+		t.Fatalf("unexpected message %q", e.Fields[0].Message)
+	}
+	//gRPC的错误详情中保留字段名与错误信息
+	decoded := FromError(status.ErrorProto(FromError(err).GRPCStatus().Proto()))
+	if len(decoded.Fields) != 2 || decoded.Fields[1].Field != "sub.age" {
+		t.Fatalf("unexpected decoded fields %+v", decoded.Fields)
+	}
+}
+
+type SignupDemo struct {
+	Mobile   string `json:"mobile" binding:"mobile_cn"`
+	Age      int    `json:"age" binding:"adult"`
+	Password string `json:"password"`
+	Confirm  string `json:"confirm"`
+}
+
+func (d *SignupDemo) Validate(ctx context.Context) error {
+	if d.Mobile == "13800000000" {
+		return AlreadyExists("mobile %s is registered", d.Mobile)
+	}
+	if d.Age > 150 {
+		return errors.New("age must be <= 100% of 150")
+	}
+	return nil
+}
+
+type SignupServer struct {
+}
+
+func (s *SignupServer) Signup(ctx context.Context, in *SignupDemo) error {
+	return nil
+}
+
+func TestCustomValidation(t *testing.T) {
+	mobile := func(fl validator.FieldLevel) bool {
+		return len(fl.Field().String()) == 11 && strings.HasPrefix(fl.Field().String(), "1")
+	}
+	confirm := func(sl validator.StructLevel) {
+		if d := sl.Current().Interface().(SignupDemo); d.Password != d.Confirm {
+			sl.ReportError(d.Confirm, "confirm", "Confirm", "eqfield", "password")
+		}
+	}
+	svc, _ := newTestServer(t, WithReceiver("signup", &SignupServer{}),
+		WithValidationRule("mobile_cn", mobile, map[string]string{"zh": "{0}必须是100%有效的手机号码", "en": "{0} must be a valid mobile number"}),
+		WithValidationAlias("adult", "min=18", map[string]string{"en": "{0} must be an adult"}),
+		WithStructValidation(confirm, SignupDemo{}))
+	call := func(data string) *Error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "zh"))
+		_, err := svc.handlers["signup"](ctx, &common.InvocationEvent{Data: []byte(data)})
+		return FromError(err)
+	}
+	if e := call(`{"mobile":"13900000000","age":20,"password":"a","confirm":"a"}`); e != nil {
+		t.Fatal(e)
+	}
+	e := call(`{"mobile":"123","age":10,"password":"a","confirm":"b"}`)
+	if e == nil || len(e.Fields) != 3 {
+		t.Fatalf("unexpected error %+v", e)
+	}
+	if e.Fields[0].Rule != "mobile_cn" || e.Fields[0].Message != "mobile必须是100%有效的手机号码" || !strings.HasPrefix(e.Message, e.Fields[0].Message+"; ") {
+		t.Fatalf("unexpected field error %+v", e.Fields[0])
+	}
+	if e.Fields[1].Rule != "adult" || e.Fields[2].Field != "confirm" || e.Fields[2].Rule != "eqfield" {
+		t.Fatalf("unexpected field errors %+v", e.Fields)
+	}
+	//标签校验通过后调用入参的Validate
+	if e := call(`{"mobile":"13800000000","age":20}`); e == nil || e.Code != CodeAlreadyExists {
+		t.Fatalf("expected error from Validate got %v", e)
+	}
+	if e := call(`{"mobile":"13900000000","age":200}`); e == nil || e.Code != CodeInvalidArgument || e.Message != "age must be <= 100% of 150" {
+		t.Fatalf("plain error from Validate should be invalid argument got %v", e)
+	}
+}
+
+type ReplyServer struct {
+}
+
+func (s *ReplyServer) Broken(ctx context.Context, in *TagDemo) (*TagDemo, error) {
+	return &TagDemo{}, nil
+}
+
+func TestReplyValidation(t *testing.T) {
+	in := &common.InvocationEvent{Data: []byte(`{"name":"a"}`)}
+	svc, _ := newTestServer(t, WithDevelopment(true), WithReplyValidation(true), WithReceiver("reply", &ReplyServer{}))
+	if _, err := svc.handlers["broken"](context.Background(), in); FromError(err).Code != CodeInternal {
+		t.Fatalf("expected internal error in development mode got %v", err)
+	}
+
+	var buf bytes.Buffer
+	svc, server := newTestServer(t, WithLogger(log.New(&buf, "", 0)), WithReplyValidation(true), WithReceiver("reply", &ReplyServer{}))
+	if _, err := svc.handlers["broken"](context.Background(), in); err != nil {
+		t.Fatalf("invalid reply should only be logged in production mode: %v", err)
+	}
+	if !strings.Contains(buf.String(), "invalid reply") || server.MethodStates()[0].Stats.InvalidReplies != 1 {
+		t.Fatalf("invalid reply should be logged and counted\n%s", buf.String())
+	}
+}
+
+type QueryDemo struct {
+	Keyword string        `json:"keyword" mod:"trim,lower" binding:"required"`
+	Page    int           `json:"page" default:"1"`
+	Size    *int          `json:"size" default:"20"`
+	Exact   bool          `json:"exact" default:"true"`
+	Tags    []string      `json:"tags" mod:"upper"`
+	Labels  []string      `json:"labels" default:"a,b"`
+	Timeout time.Duration `json:"timeout" default:"1m30s"`
+	Filter  struct {
+		Order string `json:"order" default:"desc"`
+	} `json:"filter"`
+}
+
+type QueryServer struct {
+}
+
+func (s *QueryServer) Query(ctx context.Context, in *QueryDemo) (*QueryDemo, error) {
+	return in, nil
+}
+
+type BadTagServer struct {
+}
+
+type SliceTagServer struct {
+}
+
+func (s *SliceTagServer) Query(ctx context.Context, in *struct {
+	Items []struct {
+		Page int `json:"page" default:"1"`
+	} `json:"items"`
+}) error {
+	return nil
+}
+
+func (s *BadTagServer) Query(ctx context.Context, in *struct {
+	Page int `json:"page" default:"first"`
+}) error {
+	return nil
+}
+
+func TestFieldTags(t *testing.T) {
+	svc, _ := newTestServer(t, WithReceiver("query", &QueryServer{}))
+	out, err := svc.handlers["query"](context.Background(), &common.InvocationEvent{Data: []byte(`{"keyword":"  Dapr ","page":3,"tags":["x","y"]}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &QueryDemo{}
+	if err := json.Unmarshal(out.Data, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Keyword != "dapr" || got.Page != 3 || got.Size == nil || *got.Size != 20 || strings.Join(got.Tags, ",") != "X,Y" || strings.Join(got.Labels, ",") != "a,b" ||
+		got.Timeout != 90*time.Second || got.Filter.Order != "desc" || !got.Exact {
+		t.Fatalf("unexpected input %+v", got)
+	}
+	//显式传递的零值不被默认值覆盖
+	out, err = svc.handlers["query"](context.Background(), &common.InvocationEvent{Data: []byte(`{"keyword":"a","page":0,"size":0,"exact":false,"labels":[],"filter":{"order":""}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = &QueryDemo{}
+	if err := json.Unmarshal(out.Data, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Page != 0 || got.Size == nil || *got.Size != 0 || got.Exact || len(got.Labels) != 0 || got.Filter.Order != "" {
+		t.Fatalf("explicit zero values should be kept %+v", got)
+	}
+	//规范化在校验之前执行
+	if _, err := svc.handlers["query"](context.Background(), &common.InvocationEvent{Data: []byte(`{"keyword":"   "}`)}); FromError(err).Code != CodeInvalidArgument {
+		t.Fatalf("expected validation error got %v", err)
+	}
+
+	out, err = svc.handlers[signatureMethod](context.Background(), &common.InvocationEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &serviceSignature{}
+	if err := yaml.Unmarshal(out.Data, sig); err != nil {
+		t.Fatal(err)
+	}
+	if defaults := sig.Receivers[0].Spec[0].Defaults; defaults["page"] != "1" || defaults["filter.order"] != "desc" || len(defaults) != 6 {
+		t.Fatalf("unexpected defaults in signature %v", defaults)
+	}
+
+	_, err = NewServer(testServerOptions(WithReceivers(Receiver{ClassName: "bad", Svr: &BadTagServer{}, Strict: true}))...)
+	var regErr *RegistrationError
+	if !errors.As(err, &regErr) || !regErr.HasReason(RejectUnsupportedField) {
+		t.Fatalf("invalid default should be rejected got %v", err)
+	}
+	_, err = NewServer(testServerOptions(WithReceivers(Receiver{ClassName: "bad", Svr: &SliceTagServer{}, Strict: true}))...)
+	if !errors.As(err, &regErr) || !regErr.HasReason(RejectUnsupportedField) {
+		t.Fatalf("default in slice elements should be rejected got %v", err)
+	}
+}
+
+type LegacyDemo struct {
+	ID    int       `json:"id"`
+	Phone string    `json:"phone"`
+	Flag  bool      `json:"flag"`
+	Items []SubDemo `json:"items"`
+}
+
+type DecodeServer struct {
+}
+
+func (s *DecodeServer) Strict(ctx context.Context, in *ValidDemo) (*ValidDemo, error) {
+	return in, nil
+}
+
+func (s *DecodeServer) Lenient(ctx context.Context, in *LegacyDemo) (*LegacyDemo, error) {
+	return in, nil
+}
+
+func TestDecodeMode(t *testing.T) {
+	svc, _ := newTestServer(t, WithReceiver("decode", &DecodeServer{}),
+		WithDecodeMode(DecodeStrict), WithMethodDecodeMode("lenient", DecodeLenient))
+	if _, err := svc.handlers["strict"](context.Background(), &common.InvocationEvent{Data: []byte(`{"name":"a","sub":{"age":1}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := svc.handlers["strict"](context.Background(), &common.InvocationEvent{Data: []byte(`{"name":"a","sub":{"ages":1}}`)})
+	if e := FromError(err); e.Code != CodeInvalidArgument || len(e.Fields) != 1 || e.Fields[0].Field != "sub.ages" {
+		t.Fatalf("expected unknown field sub.ages got %+v", e)
+	}
+	_, err = svc.handlers["strict"](context.Background(), &common.InvocationEvent{Data: []byte("name: a\nage: 1\n"), ContentType: "application/yaml"})
+	if e := FromError(err); e.Code != CodeInvalidArgument || e.Fields[0].Field != "age" {
+		t.Fatalf("expected unknown field age got %+v", e)
+	}
+
+	out, err := svc.handlers["lenient"](context.Background(), &common.InvocationEvent{Data: []byte(`{"id":"12","phone":13800000000,"flag":"true","items":[{"id":"3"}],"extra":1}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &LegacyDemo{}
+	if err := json.Unmarshal(out.Data, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 12 || got.Phone != "13800000000" || !got.Flag || got.Items[0].ID != 3 {
+		t.Fatalf("unexpected input %+v", got)
+	}
+}
@@ -0,0 +1,225 @@
+package dapr_sdk_warpper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//DecodeMode 入参的解码模式，只对JSON与YAML生效
+type DecodeMode int
+
+const (
+	DecodeDefault DecodeMode = iota //忽略未知的字段
+	DecodeStrict                    //拒绝未知的字段，错误中指出字段的路径
+	DecodeLenient                   //接受以字符串传递的数字与布尔值，以及以数字传递的字符串
+)
+
+func (m DecodeMode) check() error {
+	if m < DecodeDefault || m > DecodeLenient {
+		return fmt.Errorf("invalid decode mode %d", m)
+	}
+	return nil
+}
+
+//函数的解码模式，WithMethodDecodeMode优先于WithDecodeMode
+func (server *daprServer) methodDecodeMode(route string) DecodeMode {
+	if mode, ok := server.decodeModes[route]; ok {
+		return mode
+	}
+	return server.decodeMode
+}
+
+var typeOfJSONUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+//按解码模式解码入参，JSON与YAML以外的编解码忽略解码模式
+func decodeInput(codec Codec, data []byte, v interface{}, mode DecodeMode) error {
+	if mode == DecodeDefault {
+		return codec.Unmarshal(data, v)
+	}
+	switch codec {
+	case JSONCodec:
+	case YAMLCodec:
+		var tree interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return err
+		}
+		var err error
+		if data, err = json.Marshal(tree); err != nil {
+			return err
+		}
+	default:
+		return codec.Unmarshal(data, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(v)
+	switch mode {
+	case DecodeStrict:
+		if path := unknownField(tree, t, ""); path != "" {
+			e := InvalidArgument("unknown field %s", path)
+			e.Fields = []FieldError{{Field: path, Rule: "unknown_field", Message: "unknown field " + path}}
+			return e
+		}
+	case DecodeLenient:
+		var err error
+		if data, err = json.Marshal(coerce(tree, t)); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+//Struct中按json名称查找的字段类型，与encoding/json一样展开嵌入的Struct并且不区分大小写
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonFieldName(field)
+		if field.Anonymous && name == "" && derefType(field.Type).Kind() == reflect.Struct {
+			for k, ft := range jsonFields(derefType(field.Type)) {
+				if _, ok := fields[k]; !ok {
+					fields[k] = ft
+				}
+			}
+			continue
+		}
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
+
+//自定义了UnmarshalJSON的类型由其自己解析
+func customJSON(t reflect.Type) bool {
+	return t.Implements(typeOfJSONUnmarshaler) || reflect.PtrTo(t).Implements(typeOfJSONUnmarshaler)
+}
+
+//去掉指针，与indirectType不同，保留切片
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+//返回第一个在目标类型中不存在的字段的路径，不存在时返回空
+func unknownField(node interface{}, t reflect.Type, path string) string {
+	t = derefType(t)
+	if customJSON(t) {
+		return ""
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for _, k := range keys {
+				ft, ok := fields[strings.ToLower(k)]
+				if !ok {
+					return joinPath(path, k)
+				}
+				if p := unknownField(n[k], ft, joinPath(path, k)); p != "" {
+					return p
+				}
+			}
+		case reflect.Map:
+			for _, k := range keys {
+				if p := unknownField(n[k], t.Elem(), joinPath(path, k)); p != "" {
+					return p
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, item := range n {
+				if p := unknownField(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); p != "" {
+					return p
+				}
+			}
+		}
+	}
+	return ""
+}
+
+//按目标类型转换数字、字符串与布尔值
+func coerce(node interface{}, t reflect.Type) interface{} {
+	t = derefType(t)
+	if customJSON(t) {
+		return node
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if n, ok := node.(map[string]interface{}); ok {
+			fields := jsonFields(t)
+			for k, v := range n {
+				if ft, ok := fields[strings.ToLower(k)]; ok {
+					n[k] = coerce(v, ft)
+				}
+			}
+		}
+	case reflect.Map:
+		if n, ok := node.(map[string]interface{}); ok {
+			for k, v := range n {
+				n[k] = coerce(v, t.Elem())
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if n, ok := node.([]interface{}); ok {
+			for i, v := range n {
+				n[i] = coerce(v, t.Elem())
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if s, ok := node.(string); ok {
+			s = strings.TrimSpace(s)
+			if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+				return json.Number(s)
+			}
+		}
+	case reflect.Bool:
+		if s, ok := node.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+				return b
+			}
+		}
+	case reflect.String:
+		switch v := node.(type) {
+		case json.Number:
+			return v.String()
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return node
+}
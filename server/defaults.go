@@ -0,0 +1,252 @@
+package dapr_sdk_warpper
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//入参的标签
+//default:"10" 解码前设置的默认值，请求中出现的字段覆盖默认值，切片以逗号分隔，time.Duration使用"1m30s"的格式
+//default只对入参及其嵌套的Struct值生效，指针指向的Struct与切片的元素由解码创建，不支持default
+//mod:"trim,lower" 解码后、校验前依次规范化字符串或者字符串切片
+const (
+	defaultTag = "default"
+	modTag     = "mod"
+)
+
+var typeOfDuration = reflect.TypeOf(time.Duration(0))
+
+//mod标签支持的规范化
+var modifiers = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"ltrim": func(s string) string { return strings.TrimLeft(s, " \t\r\n") },
+	"rtrim": func(s string) string { return strings.TrimRight(s, " \t\r\n") },
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+//在解码前按default标签设置新建入参的默认值
+func applyDefaults(v reflect.Value) error {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if tag, ok := field.Tag.Lookup(defaultTag); ok {
+			if err := setDefault(fv, tag); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		//嵌套的Struct值
+		if fv.Kind() == reflect.Struct {
+			if err := applyDefaults(fv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//在解码后按mod标签规范化入参
+func applyMods(v reflect.Value) error {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if tag, ok := field.Tag.Lookup(modTag); ok {
+			if err := applyModifiers(fv, tag); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		//嵌套的Struct
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := applyMods(fv); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Ptr && !fv.IsNil():
+			if err := applyMods(fv); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Slice:
+			for j := 0; j < fv.Len(); j++ {
+				if err := applyMods(fv.Index(j)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func setDefault(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setDefault(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.Type() == typeOfDuration {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := []string{}
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setDefault(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("default is not supported for %s", v.Type())
+	}
+	return nil
+}
+
+func applyModifiers(v reflect.Value, tag string) error {
+	for _, name := range strings.Split(tag, ",") {
+		modify, ok := modifiers[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown modifier %q", name)
+		}
+		if err := modifyStrings(v, modify); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func modifyStrings(v reflect.Value, modify func(string) string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(modify(v.String()))
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("mod is not supported for %s", v.Type())
+		}
+		if !v.IsNil() {
+			v.Elem().SetString(modify(v.Elem().String()))
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("mod is not supported for %s", v.Type())
+		}
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).SetString(modify(v.Index(i).String()))
+		}
+	default:
+		return fmt.Errorf("mod is not supported for %s", v.Type())
+	}
+	return nil
+}
+
+//收集入参中的默认值用于函数签名，key为json字段的路径，同时检查标签是否可用
+func fieldDefaults(t reflect.Type) (map[string]string, error) {
+	defaults := map[string]string{}
+	if err := collectDefaults(indirectType(t), "", true, defaults, map[reflect.Type]bool{}); err != nil {
+		return nil, err
+	}
+	if len(defaults) == 0 {
+		return nil, nil
+	}
+	return defaults, nil
+}
+
+//filled为false时Struct由解码创建，其中的default无法生效
+func collectDefaults(t reflect.Type, prefix string, filled bool, defaults map[string]string, visiting map[reflect.Type]bool) error {
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		path := prefix
+		if !field.Anonymous {
+			name := jsonFieldName(field)
+			if name == "" {
+				name = field.Name
+			}
+			path = prefix + name
+		}
+		if tag, ok := field.Tag.Lookup(modTag); ok {
+			if err := applyModifiers(reflect.New(field.Type).Elem(), tag); err != nil {
+				return fmt.Errorf("field %s: %w", path, err)
+			}
+		}
+		if tag, ok := field.Tag.Lookup(defaultTag); ok {
+			if !filled {
+				return fmt.Errorf("field %s: default is not supported in pointer structs or slice elements", path)
+			}
+			if err := setDefault(reflect.New(field.Type).Elem(), tag); err != nil {
+				return fmt.Errorf("field %s: %w", path, err)
+			}
+			defaults[path] = tag
+		}
+		if path != "" && !field.Anonymous {
+			path += "."
+		}
+		nested := field.Type
+		if err := collectDefaults(indirectType(nested), path, filled && nested.Kind() == reflect.Struct, defaults, visiting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dapr/go-sdk/service/common"
+	validator "github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//Code 错误码，可以同时对应HTTP状态码与gRPC状态码
+type Code string
+
+const (
+	CodeUnknown            Code = "UNKNOWN"
+	CodeInvalidArgument    Code = "INVALID_ARGUMENT"
+	CodeNotFound           Code = "NOT_FOUND"
+	CodeAlreadyExists      Code = "ALREADY_EXISTS"
+	CodePermissionDenied   Code = "PERMISSION_DENIED"
+	CodeUnauthenticated    Code = "UNAUTHENTICATED"
+	CodeResourceExhausted  Code = "RESOURCE_EXHAUSTED"
+	CodeFailedPrecondition Code = "FAILED_PRECONDITION"
+	CodeDeadlineExceeded   Code = "DEADLINE_EXCEEDED"
+	CodeCanceled           Code = "CANCELED"
+	CodeUnimplemented      Code = "UNIMPLEMENTED"
+	CodeUnavailable        Code = "UNAVAILABLE"
+	CodeInternal           Code = "INTERNAL"
+)
+
+//gRPC状态码中错误详情的Domain，用于识别本SDK产生的错误
+const errorDomain = "dapr-sdk-warpper"
+
+//HTTPStatus 错误码对应的HTTP状态码
+func (c Code) HTTPStatus() int {
+	switch c {
+	case CodeInvalidArgument, CodeFailedPrecondition:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeAlreadyExists:
+		return http.StatusConflict
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case CodeCanceled:
+		return 499
+	case CodeUnimplemented:
+		return http.StatusNotImplemented
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+//GRPCCode 错误码对应的gRPC状态码
+func (c Code) GRPCCode() codes.Code {
+	switch c {
+	case CodeInvalidArgument:
+		return codes.InvalidArgument
+	case CodeNotFound:
+		return codes.NotFound
+	case CodeAlreadyExists:
+		return codes.AlreadyExists
+	case CodePermissionDenied:
+		return codes.PermissionDenied
+	case CodeUnauthenticated:
+		return codes.Unauthenticated
+	case CodeResourceExhausted:
+		return codes.ResourceExhausted
+	case CodeFailedPrecondition:
+		return codes.FailedPrecondition
+	case CodeDeadlineExceeded:
+		return codes.DeadlineExceeded
+	case CodeCanceled:
+		return codes.Canceled
+	case CodeUnimplemented:
+		return codes.Unimplemented
+	case CodeUnavailable:
+		return codes.Unavailable
+	case CodeInternal:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+//gRPC状态码对应的错误码
+func codeFromGRPC(c codes.Code) Code {
+	for _, code := range []Code{
+		CodeInvalidArgument, CodeNotFound, CodeAlreadyExists, CodePermissionDenied,
+		CodeUnauthenticated, CodeResourceExhausted, CodeFailedPrecondition, CodeDeadlineExceeded,
+		CodeCanceled, CodeUnimplemented, CodeUnavailable, CodeInternal,
+	} {
+		if code.GRPCCode() == c {
+			return code
+		}
+	}
+	return CodeUnknown
+}
+
+//Error 返回给调用方的错误，HTTP服务转换为对应的状态码与JSON内容，gRPC服务转换为带详情的状态码
+type Error struct {
+	Code      Code              `json:"code"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable"`        //调用方是否可以重试
+	Fields    []FieldError      `json:"fields,omitempty"` //参数校验未通过的字段
+
+	cause error //由FromError转换时的原始错误
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+//WithDetail 增加一项错误详情
+func (e *Error) WithDetail(key, value string) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+//WithRetryable 标记调用方可以重试
+func (e *Error) WithRetryable() *Error {
+	e.Retryable = true
+	return e
+}
+
+//GRPCStatus 转换为gRPC状态码，gRPC服务返回错误时会自动调用
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code.GRPCCode(), e.Message)
+	info := &errdetails.ErrorInfo{
+		Reason:   string(e.Code),
+		Domain:   errorDomain,
+		Metadata: e.Details,
+	}
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	if e.Retryable {
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{}); err == nil {
+			st = detailed
+		}
+	}
+	//gRPC的错误详情中只保留字段名与错误信息
+	if len(e.Fields) > 0 {
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(e.Fields))
+		for _, f := range e.Fields {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message})
+		}
+		if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+			st = detailed
+		}
+	}
+	return st
+}
+
+//NewError 创建指定错误码的错误
+func NewError(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+//InvalidArgument 参数错误
+func InvalidArgument(format string, args ...interface{}) *Error {
+	return NewError(CodeInvalidArgument, format, args...)
+}
+
+//NotFound 资源不存在
+func NotFound(format string, args ...interface{}) *Error {
+	return NewError(CodeNotFound, format, args...)
+}
+
+//AlreadyExists 资源已经存在
+func AlreadyExists(format string, args ...interface{}) *Error {
+	return NewError(CodeAlreadyExists, format, args...)
+}
+
+//PermissionDenied 没有调用权限
+func PermissionDenied(format string, args ...interface{}) *Error {
+	return NewError(CodePermissionDenied, format, args...)
+}
+
+//Unauthenticated 没有通过身份认证
+func Unauthenticated(format string, args ...interface{}) *Error {
+	return NewError(CodeUnauthenticated, format, args...)
+}
+
+//ResourceExhausted 资源不足或者调用受限，可以重试
+func ResourceExhausted(format string, args ...interface{}) *Error {
+	return NewError(CodeResourceExhausted, format, args...).WithRetryable()
+}
+
+//FailedPrecondition 不满足执行的前提条件
+func FailedPrecondition(format string, args ...interface{}) *Error {
+	return NewError(CodeFailedPrecondition, format, args...)
+}
+
+//DeadlineExceeded 执行超时
+func DeadlineExceeded(format string, args ...interface{}) *Error {
+	return NewError(CodeDeadlineExceeded, format, args...)
+}
+
+//Unavailable 服务暂时不可用
+func Unavailable(format string, args ...interface{}) *Error {
+	return NewError(CodeUnavailable, format, args...)
+}
+
+//Internal 服务内部错误
+func Internal(format string, args ...interface{}) *Error {
+	return NewError(CodeInternal, format, args...)
+}
+
+//FromError 将任意错误转换为Error，可以识别Error、gRPC状态码与SDK内部的错误
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	e = fromError(err)
+	e.cause = err
+	return e
+}
+
+func fromError(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		return InvalidArgument("%s", err.Error())
+	case errors.Is(err, ErrMethodNotFound):
+		return NewError(CodeUnimplemented, "%s", err.Error())
+	case errors.Is(err, ErrMethodDisabled):
+		return Unavailable("%s", err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded("%s", err.Error())
+	case errors.Is(err, context.Canceled):
+		return NewError(CodeCanceled, "%s", err.Error())
+	}
+	if st, ok := status.FromError(err); ok {
+		return fromStatus(st)
+	}
+	return NewError(CodeUnknown, "%s", err.Error())
+}
+
+//从gRPC状态码还原错误，HTTP服务的错误内容以JSON的形式出现在Message中
+func fromStatus(st *status.Status) *Error {
+	e := &Error{Code: codeFromGRPC(st.Code()), Message: st.Message()}
+	decoded := false
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if d.Domain == errorDomain {
+				e.Code = Code(d.Reason)
+				e.Details = d.Metadata
+				decoded = true
+			}
+		case *errdetails.RetryInfo:
+			e.Retryable = true
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				e.Fields = append(e.Fields, FieldError{Field: v.Field, Message: v.Description})
+			}
+		}
+	}
+	if !decoded {
+		body := &Error{}
+		if err := json.Unmarshal([]byte(st.Message()), body); err == nil && body.Code != "" {
+			return body
+		}
+	}
+	return e
+}
+
+type errorHolderKey struct{}
+
+//保存处理函数返回的错误，用于HTTP服务输出对应的状态码
+type errorHolder struct {
+	err *Error
+}
+
+//记录返回给HTTP服务的错误
+func recordError(ctx context.Context, e *Error) {
+	if holder, ok := ctx.Value(errorHolderKey{}).(*errorHolder); ok {
+		holder.err = e
+	}
+}
+
+//HTTP服务在处理函数返回错误时，按Error输出状态码与JSON内容
+func withErrorStatus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		holder := &errorHolder{}
+		ctx := context.WithValue(r.Context(), errorHolderKey{}, holder)
+		next.ServeHTTP(&errorStatusWriter{ResponseWriter: w, holder: holder}, r.WithContext(ctx))
+	})
+}
+
+//dapr的HTTP服务出错时固定输出500与错误文本，在这里替换为Error的内容
+type errorStatusWriter struct {
+	http.ResponseWriter
+	holder   *errorHolder
+	replaced bool
+}
+
+func (w *errorStatusWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusInternalServerError && w.holder.err != nil {
+		data, err := json.Marshal(w.holder.err)
+		if err == nil {
+			w.replaced = true
+			w.Header().Set("Content-Type", "application/json")
+			w.ResponseWriter.WriteHeader(w.holder.err.Code.HTTPStatus())
+			w.ResponseWriter.Write(data)
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *errorStatusWriter) Write(data []byte) (int, error) {
+	if w.replaced {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+//将处理函数的错误转换为Error，gRPC服务直接使用其状态码，HTTP服务记录后由withErrorStatus输出
+func withErrorModel(handler common.ServiceInvocationHandler) common.ServiceInvocationHandler {
+	return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+		out, err := handler(ctx, in)
+		if err != nil {
+			e := FromError(err)
+			recordError(ctx, e)
+			return nil, e
+		}
+		return out, nil
+	}
+}
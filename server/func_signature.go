@@ -3,66 +3,102 @@ package dapr_sdk_warpper
 import (
 	"context"
 	"reflect"
+	"sort"
 
 	"github.com/dapr/go-sdk/service/common"
 	"gopkg.in/yaml.v3"
 )
 
 type refMethodSignature struct {
-	Name string         `yaml:"name"`
-	In   []refFieldInfo `yaml:"in"`
-	Out  []refFieldInfo `yaml:"out"`
+	Name  string         `yaml:"name"`
+	Route string         `yaml:"route"`
+	In    []refFieldInfo `yaml:"in"`
+	Out   []refFieldInfo `yaml:"out"`
+	//函数没有入参或者出参时，与空Struct区分
+	NoInput  bool `yaml:"no_input,omitempty"`
+	NoOutput bool `yaml:"no_output,omitempty"`
+	//入参的默认值，key为json字段的路径
+	Defaults map[string]string `yaml:"defaults,omitempty"`
+	//允许调用的dapr服务，不限制调用方时为空
+	Permission *methodPermission `yaml:"permission,omitempty"`
+	//对调用方JWT的要求
+	Auth *AuthRequirement `yaml:"auth,omitempty"`
 }
 
-type serviceSignature struct {
+//一个函数组的签名
+type receiverSignature struct {
 	APIVersion string                `yaml:"apiVersion"`
 	Spec       []*refMethodSignature `yaml:"spec"`
 }
 
+//同一个dapr服务上全部函数组的签名
+type serviceSignature struct {
+	Receivers []*receiverSignature `yaml:"receivers"`
+}
+
 //获取服务函数的签名
 func (server *daprServer) getSignature() (*serviceSignature, error) {
 	sig := &serviceSignature{
-		APIVersion: server.svcName,
-	}
-	if server.service == nil {
-		return sig, nil
+		Receivers: make([]*receiverSignature, 0, len(server.services)),
 	}
-	methodMap := server.service.method
-	mCount := len(methodMap)
-	sig.Spec = make([]*refMethodSignature, mCount)
-	m := 0
-	var in []refFieldInfo
-	var out []refFieldInfo
-	var err error
-	for name, method := range methodMap {
-		argvType := indirectType(method.ArgType)
-		replyType := method.ReplyType
-		in, err = structToYaml(reflect.New(argvType).Elem().Addr().Interface())
+	for _, s := range server.services {
+		rs, err := getReceiverSignature(s)
 		if err != nil {
 			return nil, err
 		}
+		sig.Receivers = append(sig.Receivers, rs)
+	}
+	return sig, nil
+}
 
-		if replyType.Kind() == reflect.Interface {
-			out = []refFieldInfo{}
-		}
-		if replyType.Kind() == reflect.Ptr {
-			replyType = indirectType(replyType) //fix: 这里没有使用indirect导致下面的代码New了一个Interface
-			out, err = structToYaml(reflect.New(replyType).Elem().Addr().Interface())
-			if err != nil {
-				return nil, err
-			}
-		}
-
+//获取一个函数组的签名，函数按名称排序
+func getReceiverSignature(s *service) (*receiverSignature, error) {
+	sig := &receiverSignature{
+		APIVersion: s.name,
+	}
+	methodMap := s.method
+	names := make([]string, 0, len(methodMap))
+	for name := range methodMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sig.Spec = make([]*refMethodSignature, len(names))
+	for m, name := range names {
+		method := methodMap[name]
 		sig.Spec[m] = &refMethodSignature{
-			Name: name,
-			In:   in,
-			Out:  out,
+			Name:       name,
+			Route:      method.route,
+			In:         method.inFields,
+			Out:        method.outFields,
+			NoInput:    !method.hasInput(),
+			NoOutput:   !method.hasOutput(),
+			Defaults:   method.defaults,
+			Permission: s.permissions[name],
+			Auth:       s.auth[name],
 		}
-		m++
 	}
 	return sig, nil
 }
 
+//获取函数入参与出参的字段，没有入参或者出参时对应的结果为nil
+func getMethodFields(method *methodType) (in []refFieldInfo, out []refFieldInfo, err error) {
+	if method.hasInput() {
+		argvType := indirectType(method.ArgType)
+		in, err = structToYaml(reflect.New(argvType).Elem().Addr().Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if method.hasOutput() {
+		replyType := indirectType(method.ReplyType) //fix: 这里没有使用indirect导致下面的代码New了一个Interface
+		out, err = structToYaml(reflect.New(replyType).Elem().Addr().Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return in, out, nil
+}
+
 //输出服务函数的签名Yaml
 func (server *daprServer) getSignatureYaml() (string, error) {
 	sig := server.signature
@@ -86,3 +122,35 @@ func (server *daprServer) invokeSignature(ctx context.Context, in *common.Invoca
 		ContentType: "application/yaml",
 	}, nil
 }
+
+//获取函数签名的调用名称，按各函数组的路由规则去重
+func (server *daprServer) signatureRoutes() []string {
+	routes := []string{signatureMethod}
+	for _, s := range server.services {
+		route := s.route.Route(s.name, signatureMethod)
+		exists := false
+		for _, r := range routes {
+			if r == route {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+//内置函数使用的调用名称，包括函数组s在其前缀下的get_signature
+func (server *daprServer) reservedRoute(s *service, route string) bool {
+	if route == methodsMethod || route == s.route.Route(s.name, signatureMethod) {
+		return true
+	}
+	for _, r := range server.signatureRoutes() {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+//通过Handle注册的函数
+type funcHandler struct {
+	name string
+	fn   reflect.Value
+}
+
+//Handle 不需要定义接收者Struct，直接将一个函数注册到函数组中
+//函数与接收者的函数使用相同的解码、校验、编码流程，并且同样出现在函数签名中
+//@Param r 函数所在的函数组，Svr可以为空
+//@Param name 对外暴露的函数名，不经过NamingStrategy转换，name为空或者fn为nil时注册失败
+func Handle[In, Out any](r *Receiver, name string, fn func(ctx context.Context, in *In) (*Out, error)) {
+	r.funcs = append(r.funcs, funcHandler{name: name, fn: reflect.ValueOf(fn)})
+}
+
+//将Handle注册的函数转换为统一的methodType
+func funcMethod(f funcHandler) *methodType {
+	ftype := f.fn.Type()
+	return &methodType{
+		method:    reflect.Method{Name: f.name, Type: ftype},
+		ArgType:   ftype.In(1),
+		ReplyType: ftype.Out(0),
+		shape:     shapeInReturn,
+		fn:        f.fn,
+	}
+}
+
+//将任意形式的函数转换为methodType，用于运行时替换函数的实现
+func anyFuncMethod(name string, fn interface{}) (*methodType, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("%s: implementation must be a function", name)
+	}
+	mt, reason, detail := parseMethodType(fv.Type(), 0)
+	if mt == nil {
+		return nil, fmt.Errorf("%s: %s, %s", name, reason, detail)
+	}
+	mt.method = reflect.Method{Name: name, Type: fv.Type()}
+	mt.fn = fv
+	return mt, nil
+}
@@ -29,6 +29,19 @@ func camelToLowerStyle(src string) string {
 	return strings.Join(names, "_")
 }
 
+func camelToKebabStyle(src string) string {
+	return strings.ReplaceAll(camelToLowerStyle(src), "_", "-")
+}
+
+func camelToLowerCamelStyle(src string) string {
+	names := camelSplit(src)
+	if len(names) == 0 {
+		return src
+	}
+	names[0] = strings.ToLower(names[0])
+	return strings.Join(names, "")
+}
+
 func camelSplit(src string) (entries []string) {
 	// don't split invalid utf8
 	if !utf8.ValidString(src) {
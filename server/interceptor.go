@@ -0,0 +1,47 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"reflect"
+)
+
+//MethodInfo 被调用函数的信息
+type MethodInfo struct {
+	Route     string       //调用名称
+	Receiver  string       //函数组的名称
+	Method    string       //Go的函数名
+	ArgType   reflect.Type //入参的类型，函数没有入参时为nil
+	ReplyType reflect.Type //出参的类型，函数没有出参时为nil
+}
+
+//InvokeFunc 执行后续的拦截器与函数，函数没有入参时in为nil，没有出参时返回nil
+type InvokeFunc func(ctx context.Context, in interface{}) (interface{}, error)
+
+//Interceptor 拦截函数调用，在入参解码与校验之后、出参编码之前执行
+//调用next继续执行，也可以不调用next直接返回结果或错误
+type Interceptor func(ctx context.Context, info *MethodInfo, in interface{}, next InvokeFunc) (interface{}, error)
+
+//组合拦截器，先添加的拦截器位于外层
+func chainInterceptors(invoke InvokeFunc, info *MethodInfo, interceptors []Interceptor) InvokeFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, in interface{}) (interface{}, error) {
+			return interceptor(ctx, info, in, next)
+		}
+	}
+	return invoke
+}
+
+//函数表中一项的信息
+func (entry *methodEntry) info() *MethodInfo {
+	info := &MethodInfo{
+		Route:    entry.mtype.route,
+		Receiver: entry.service.name,
+		Method:   entry.mtype.method.Name,
+		ArgType:  entry.mtype.ArgType,
+	}
+	if entry.mtype.hasOutput() {
+		info.ReplyType = entry.mtype.ReplyType
+	}
+	return info
+}
@@ -0,0 +1,306 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+//调用方携带JWT的metadata，格式为"Bearer <token>"
+const authorizationKey = "authorization"
+
+//JWTConfig JWT认证的配置，支持HS256与RS256
+type JWTConfig struct {
+	Issuer   string                    //要求的iss，为空时不校验
+	Audience string                    //要求的aud，为空时不校验
+	HMACKey  []byte                    //HS256的密钥
+	RSAKeys  map[string]*rsa.PublicKey //RS256的公钥，key为kid
+	JWKSFile string                    //本地的JWKS文件，支持RSA与oct类型的密钥
+	Leeway   time.Duration             //校验exp与nbf时允许的时钟误差
+	//全部函数都需要有效的token，否则只有声明了AuthRequirement的函数需要，其他函数在携带token时同样校验
+	Required bool
+}
+
+//AuthRequirement 函数对调用方token的要求，在函数签名中列出
+type AuthRequirement struct {
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"` //需要全部具备的scope
+	Roles  []string `json:"roles,omitempty" yaml:"roles,omitempty"`   //需要具备其中一个的role
+}
+
+//Claims JWT中的声明
+type Claims map[string]interface{}
+
+//Subject token的sub
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+//Scopes token的scope，支持空格分隔的scope与数组形式的scp
+func (c Claims) Scopes() []string {
+	if scope, ok := c["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return c.strings("scp")
+}
+
+//Roles token的roles
+func (c Claims) Roles() []string {
+	return c.strings("roles")
+}
+
+//字符串或者字符串数组形式的声明
+func (c Claims) strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+type claimsKey struct{}
+
+//ClaimsFromContext 获取调用方token中的声明，没有携带token时返回false
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+//按kid查找的密钥，HS256为[]byte，RS256为*rsa.PublicKey
+type jwtVerifier struct {
+	config JWTConfig
+	keys   map[string][]interface{}
+}
+
+func newJWTVerifier(config *JWTConfig) (*jwtVerifier, error) {
+	if config == nil {
+		return nil, nil
+	}
+	v := &jwtVerifier{config: *config, keys: make(map[string][]interface{})}
+	if len(config.HMACKey) > 0 {
+		v.addKey("", config.HMACKey)
+	}
+	for kid, key := range config.RSAKeys {
+		v.addKey(kid, key)
+	}
+	if config.JWKSFile != "" {
+		if err := v.loadJWKS(config.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.keys) == 0 {
+		return nil, errors.New("jwt: no key configured")
+	}
+	return v, nil
+}
+
+func (v *jwtVerifier) addKey(kid string, key interface{}) {
+	v.keys[kid] = append(v.keys[kid], key)
+}
+
+//JWKS中的一个密钥
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func (v *jwtVerifier) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &jwks); err != nil {
+		return fmt.Errorf("jwks %s: %w", path, err)
+	}
+	for _, jwk := range jwks.Keys {
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return fmt.Errorf("jwks %s: key %s: %w", path, jwk.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return fmt.Errorf("jwks %s: key %s: %w", path, jwk.Kid, err)
+			}
+			v.addKey(jwk.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+		case "oct":
+			k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+			if err != nil {
+				return fmt.Errorf("jwks %s: key %s: %w", path, jwk.Kid, err)
+			}
+			v.addKey(jwk.Kid, k)
+		}
+	}
+	return nil
+}
+
+//kid为空时尝试全部密钥
+func (v *jwtVerifier) candidates(kid string) []interface{} {
+	if keys, ok := v.keys[kid]; ok || kid != "" {
+		return keys
+	}
+	var keys []interface{}
+	for _, k := range v.keys {
+		keys = append(keys, k...)
+	}
+	return keys
+}
+
+//校验签名与声明，返回token中的声明
+func (v *jwtVerifier) verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	if !v.verifySignature(header.Alg, header.Kid, signed, sig) {
+		return nil, errors.New("invalid signature")
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, v.checkClaims(claims, now)
+}
+
+func (v *jwtVerifier) verifySignature(alg, kid string, signed, sig []byte) bool {
+	hashed := sha256.Sum256(signed)
+	for _, key := range v.candidates(kid) {
+		switch k := key.(type) {
+		case []byte:
+			if alg != "HS256" {
+				continue
+			}
+			mac := hmac.New(sha256.New, k)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if alg != "RS256" {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed[:], sig) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *jwtVerifier) checkClaims(claims Claims, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.config.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return errors.New("unexpected issuer")
+	}
+	if v.config.Audience != "" && !contains(claims.strings("aud"), v.config.Audience) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//校验调用方的token与函数的要求，通过后将声明保存到ctx中
+func (server *daprServer) authenticate(ctx context.Context, route string, entry *methodEntry) (context.Context, error) {
+	v := server.jwt
+	if v == nil {
+		return ctx, nil
+	}
+	token := incomingMetadata(ctx, authorizationKey)
+	if token == "" {
+		if entry.auth != nil || v.config.Required {
+			return nil, Unauthenticated("%s: missing bearer token", route)
+		}
+		return ctx, nil
+	}
+	if len(token) < 7 || !strings.EqualFold(token[:7], "bearer ") {
+		return nil, Unauthenticated("%s: authorization is not a bearer token", route)
+	}
+	claims, err := v.verify(strings.TrimSpace(token[7:]), time.Now())
+	if err != nil {
+		return nil, Unauthenticated("%s: %v", route, err)
+	}
+	if req := entry.auth; req != nil {
+		scopes := claims.Scopes()
+		for _, scope := range req.Scopes {
+			if !contains(scopes, scope) {
+				return nil, PermissionDenied("%s: scope %s is required", route, scope)
+			}
+		}
+		if len(req.Roles) > 0 {
+			roles, allowed := claims.Roles(), false
+			for _, role := range req.Roles {
+				allowed = allowed || contains(roles, role)
+			}
+			if !allowed {
+				return nil, PermissionDenied("%s: one of roles %v is required", route, req.Roles)
+			}
+		}
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
@@ -0,0 +1,99 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ConcurrencyLimit 并发限制，超过限制的调用返回ResourceExhausted错误(HTTP状态码429)
+type ConcurrencyLimit struct {
+	MaxInFlight  int           //同时执行的最大调用数，0表示不限制
+	MaxQueue     int           //超过并发数时最多等待的调用数，0表示不等待
+	QueueTimeout time.Duration //在队列中等待的最长时间，0表示等待到调用的deadline
+}
+
+func (l ConcurrencyLimit) check() error {
+	if l.MaxInFlight < 0 || l.MaxQueue < 0 || l.QueueTimeout < 0 {
+		return errors.New("concurrency limit is negative")
+	}
+	return nil
+}
+
+//按ConcurrencyLimit限制并发，由全部调用共享
+type limiter struct {
+	slots   chan struct{}
+	queue   chan struct{} //为nil时不等待
+	timeout time.Duration
+}
+
+//不限制并发时返回nil
+func newLimiter(l ConcurrencyLimit) *limiter {
+	if l.MaxInFlight <= 0 {
+		return nil
+	}
+	lim := &limiter{slots: make(chan struct{}, l.MaxInFlight), timeout: l.QueueTimeout}
+	if l.MaxQueue > 0 {
+		lim.queue = make(chan struct{}, l.MaxQueue)
+	}
+	return lim
+}
+
+//获取执行的位置，成功后需要调用release
+func (l *limiter) acquire(ctx context.Context, route string) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.queue == nil {
+		return ResourceExhausted("%s: too many concurrent calls", route)
+	}
+	select {
+	case l.queue <- struct{}{}:
+		defer func() { <-l.queue }()
+	default:
+		return ResourceExhausted("%s: too many queued calls", route)
+	}
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ResourceExhausted("%s: queue timeout after %s", route, l.timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *limiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+//先获取函数自己的位置，再获取全局的位置
+func (server *daprServer) acquire(ctx context.Context, route string, entry *methodEntry) (func(), error) {
+	if err := entry.limiter.acquire(ctx, route); err != nil {
+		return nil, err
+	}
+	if err := server.limiter.acquire(ctx, route); err != nil {
+		entry.limiter.release()
+		return nil, err
+	}
+	entry.stats.update(func(stats *MethodStats) { stats.InFlight++ })
+	return func() {
+		entry.stats.update(func(stats *MethodStats) { stats.InFlight-- })
+		server.limiter.release()
+		entry.limiter.release()
+	}, nil
+}
@@ -2,19 +2,18 @@ package dapr_sdk_warpper
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"go/token"
 	"log"
+	"net/url"
 	"os"
 	"reflect"
+	"runtime/debug"
+	"sync"
 	"time"
 
-	"github.com/dapr/go-sdk/client"
 	"github.com/dapr/go-sdk/service/common"
-	dapr_grpc "github.com/dapr/go-sdk/service/grpc"
-	dapr_http "github.com/dapr/go-sdk/service/http"
+	ut "github.com/go-playground/universal-translator"
 	validator "github.com/go-playground/validator/v10"
 )
 
@@ -29,83 +28,259 @@ const (
 type InvokeHandle func(ctx context.Context, in, out interface{}) error
 type ServiceCreator func() common.Service
 
-var defaultClient client.Client
-var logger = log.New(os.Stderr, "hgmicro_sdk: ", log.LstdFlags)
-var validate = validator.New()
+//未通过Option指定时，新建服务与客户端使用的Logger
+var defaultLogger = struct {
+	sync.RWMutex
+	logger *log.Logger
+}{logger: log.New(os.Stderr, "hgmicro_sdk: ", log.LstdFlags)}
+
+func getDefaultLogger() *log.Logger {
+	defaultLogger.RLock()
+	defer defaultLogger.RUnlock()
+	return defaultLogger.logger
+}
+
+//兼容gin-binding，使用"binding"标签的Validator，每个服务独立创建
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	return v
+}
 
 type daprServer struct {
-	svcName   string
-	service   *service
-	daprSvr   common.Service
-	signature *serviceSignature
-	svrType   ServerType
+	services    []*service // 按注册顺序保存的函数组
+	daprSvr     common.Service
+	signature   *serviceSignature
+	svrType     ServerType
+	logger      *log.Logger
+	validate    *validator.Validate
+	translators *ut.UniversalTranslator // 校验错误的翻译
+	codec       Codec                   // 默认的编解码
+	codecs      *CodecRegistry          // 按Content-Type选择的编解码
+	middlewares []Middleware
+	//全部函数的拦截器，在函数自己的拦截器外层执行
+	interceptors []Interceptor
+	table        *methodTable                // 运行时可以修改的函数表
+	dev          bool                        // 开发模式
+	repanic      bool                        // 开发模式下恢复panic后重新抛出
+	checkReply   bool                        // 校验函数的出参
+	decodeMode   DecodeMode                  // 入参的解码模式
+	decodeModes  map[string]DecodeMode       // 按路由指定的解码模式
+	timeout      time.Duration               // 函数默认的超时时间
+	timeouts     map[string]time.Duration    // 按路由指定的超时时间
+	limiter      *limiter                    // 全部函数共享的并发限制
+	limits       map[string]ConcurrencyLimit // 按路由指定的并发限制
+	rateLimiter  *rateLimiter                // 按调用方限流，为nil时不限流
+	permissions  PermissionPolicy            // 按函数组名称配置的调用权限
+	admin        *methodPermission           // 允许调用get_methods的app-id，为nil时不开启get_methods
+	apiToken     string                      // dapr调用时需要携带的API token，为空时不校验
+	jwt          *jwtVerifier                // 校验调用方的JWT，为nil时不校验
 }
 
 func newDaprServer() *daprServer {
-	validate.SetTagName("binding")
-	return &daprServer{}
+	server := &daprServer{
+		logger: getDefaultLogger(),
+		codec:  JSONCodec,
+		codecs: NewCodecRegistry(),
+		table:  newMethodTable(),
+	}
+	server.setValidator(newValidator())
+	return server
+}
+
+//设置入参校验使用的Validator，并注册校验错误的翻译
+func (server *daprServer) setValidator(v *validator.Validate) error {
+	translators, err := newTranslator(v)
+	if err != nil {
+		return err
+	}
+	server.validate = v
+	server.translators = translators
+	return nil
 }
 
 //兼容gin-binding的参数校验
-func validParam(v reflect.Value) error {
+func (server *daprServer) validParam(v reflect.Value) error {
 	if v.Kind() == reflect.Struct {
-		return validate.Struct(v.Interface())
+		return server.validate.Struct(v.Interface())
 	} else if v.Kind() == reflect.Ptr {
-		return validParam(v.Elem())
+		return server.validParam(v.Elem())
 	}
 	return nil
 }
 
-func (server *daprServer) register(rcvr interface{}, name string, useName bool) error {
+//按名称查找已注册的函数组
+func (server *daprServer) findService(name string) *service {
+	for _, s := range server.services {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+//按调用名称(路由)查找已注册的函数，返回函数所在的函数组
+func (server *daprServer) findMethod(route string) (*service, *methodType) {
+	for _, s := range server.services {
+		for _, m := range s.method {
+			if m.route == route {
+				return s, m
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (server *daprServer) register(r Receiver) error {
 	s := new(service)
-	s.typ = reflect.TypeOf(rcvr)
-	s.rcvr = reflect.ValueOf(rcvr)
-	sname := reflect.Indirect(s.rcvr).Type().Name()
-	if useName {
-		sname = name
-	}
-	if sname == "" {
-		s := "rpc.Register: no service name for type " + s.typ.String()
-		logger.Print(s)
-		return errors.New(s)
-	}
-	if !token.IsExported(sname) && !useName {
-		s := "rpc.Register: type " + sname + " is not exported"
-		logger.Print(s)
-		return errors.New(s)
+	sname := r.ClassName
+	if server.findService(sname) != nil {
+		return server.registrationError(&RegistrationError{ClassName: sname, Cause: "service already defined"})
 	}
 	s.name = sname
+	s.route = r.Route
+	s.method = make(map[string]*methodType)
+	regErr := &RegistrationError{ClassName: sname}
 
 	// Install the methods
-	s.method = suitableMethods(s.typ, true)
+	if r.Svr != nil {
+		nameOf := methodNamer(r.Svr, r.Naming, r.Aliases)
+		s.typ = reflect.TypeOf(r.Svr)
+		s.rcvr = reflect.ValueOf(r.Svr)
+		s.method, regErr.Rejected = suitableMethods(s.typ, nameOf)
+		if len(s.method) == 0 && len(r.funcs) == 0 {
+			// To help the user, see if a pointer receiver would work.
+			method, _ := suitableMethods(reflect.PtrTo(s.typ), nameOf)
+			if len(method) != 0 {
+				regErr.Cause = "has no exported methods of suitable type (hint: pass a pointer to value of that type)"
+			} else {
+				regErr.Cause = "has no exported methods of suitable type"
+			}
+			return server.registrationError(regErr)
+		}
+	}
+	// Install the functions registered by Handle
+	for _, f := range r.funcs {
+		if f.name == "" {
+			regErr.Rejected = append(regErr.Rejected, RejectedMethod{Reason: RejectEmptyName, Detail: "function name is empty"})
+			continue
+		}
+		if f.fn.IsNil() {
+			regErr.Rejected = append(regErr.Rejected, RejectedMethod{Method: f.name, Name: f.name, Reason: RejectNilFunc, Detail: "function is nil"})
+			continue
+		}
+		if _, ok := s.method[f.name]; ok {
+			regErr.Rejected = append(regErr.Rejected, RejectedMethod{Method: f.name, Name: f.name, Reason: RejectDuplicated, Detail: "function name is duplicated"})
+			continue
+		}
+		m := funcMethod(f)
+		if err := m.loadFields(); err != nil {
+			regErr.Rejected = append(regErr.Rejected, RejectedMethod{Method: f.name, Name: f.name, Reason: RejectUnsupportedField, Detail: err.Error()})
+			continue
+		}
+		s.method[f.name] = m
+	}
+	//不同函数组注册到同一个dapr服务时，调用名称不能重复
+	for mName, m := range s.method {
+		m.route = s.route.Route(sname, mName)
+		if server.reservedRoute(s, m.route) {
+			regErr.Rejected = append(regErr.Rejected, RejectedMethod{
+				Method: m.method.Name,
+				Name:   mName,
+				Reason: RejectReservedRoute,
+				Detail: "route " + m.route + " is reserved",
+			})
+			delete(s.method, mName)
+			continue
+		}
+		if other, _ := server.findMethod(m.route); other != nil {
+			regErr.Rejected = append(regErr.Rejected, RejectedMethod{
+				Method: m.method.Name,
+				Name:   mName,
+				Reason: RejectRouteConflict,
+				Detail: "route " + m.route + " conflicts with " + other.name,
+			})
+			delete(s.method, mName)
+		}
+	}
 	if len(s.method) == 0 {
-		str := ""
-		// To help the user, see if a pointer receiver would work.
-		method := suitableMethods(reflect.PtrTo(s.typ), true)
-		if len(method) != 0 {
-			str = "rpc.Register: type " + sname + " has no exported methods of suitable type (hint: pass a pointer to value of that type)"
-		} else {
-			str = "rpc.Register: type " + sname + " has no exported methods of suitable type"
+		regErr.Cause = "has no method to register"
+		return server.registrationError(regErr)
+	}
+	for mName := range r.Interceptors {
+		if _, ok := s.method[mName]; !ok {
+			regErr.Cause = "interceptors for unknown method " + mName
+			return server.registrationError(regErr)
+		}
+	}
+	permissions := append(r.Permissions[:len(r.Permissions):len(r.Permissions)], server.permissions[sname]...)
+	var err error
+	if s.permissions, err = methodPermissions(s.method, permissions); err != nil {
+		regErr.Cause = err.Error()
+		return server.registrationError(regErr)
+	}
+	s.auth = make(map[string]*AuthRequirement, len(r.Auth))
+	for mName, req := range r.Auth {
+		if _, ok := s.method[mName]; !ok || server.jwt == nil {
+			regErr.Cause = "auth requirement for unknown method " + mName + " or without WithJWT"
+			return server.registrationError(regErr)
 		}
-		logger.Print(str)
-		return errors.New(str)
+		req := req
+		s.auth[mName] = &req
+	}
+	//严格模式下，任何一个导出的函数未能注册都会导致失败
+	if len(regErr.Rejected) > 0 {
+		if r.Strict {
+			regErr.Cause = "strict mode rejects skipped methods"
+			return server.registrationError(regErr)
+		}
+		for _, m := range regErr.Rejected {
+			server.logger.Printf("rpc.Register: %s skip method %s", sname, m)
+		}
+	}
+	server.services = append(server.services, s)
+	for mName, m := range s.method {
+		server.table.add(&methodEntry{
+			service:      s,
+			mtype:        m,
+			interceptors: r.Interceptors[mName],
+			timeout:      server.methodTimeout(r.Svr, m),
+			limiter:      newLimiter(server.limits[m.route]),
+			permission:   s.permissions[mName],
+			auth:         s.auth[mName],
+			decodeMode:   server.methodDecodeMode(m.route),
+		})
 	}
-	server.svcName = sname
-	server.service = s
 	return nil
 }
 
+//输出注册失败的原因
+func (server *daprServer) registrationError(err *RegistrationError) error {
+	server.logger.Print(err.Error())
+	return err
+}
+
 //RegistMethods 注册服务到RPC
 //@Param className svr参数注册方法后，函数组的前缀
 //@Param svr 函数组所在的Struct实例
 func (server *daprServer) registMethods(className string, svr interface{}) error {
+	return server.registReceiver(Receiver{ClassName: className, Svr: svr})
+}
+
+//registReceiver 按函数组的配置注册服务到RPC
+func (server *daprServer) registReceiver(r Receiver) error {
+	className := r.ClassName
 	if className == "" {
 		return errors.New("className is empty")
 	}
 
-	err := server.register(svr, className, true)
+	if server.daprSvr != nil {
+		return errors.New("dapr has already been hooked")
+	}
+
+	err := server.register(r)
 	if err != nil {
-		return fmt.Errorf("%s has not exported method", className)
+		return err
 	}
 
 	sig, err := server.getSignature()
@@ -116,181 +291,286 @@ func (server *daprServer) registMethods(className string, svr interface{}) error
 	return nil
 }
 
-func (server *daprServer) logMethodCall(name string, in *common.InvocationEvent, err interface{}) {
-	var realErr error
-	if err != nil {
-		realErr = err.(error)
+func (server *daprServer) logMethodCall(name string, in *common.InvocationEvent, err error) {
+	server.logger.Printf("exec [%s] by (%s) %s error:%v", name, string(in.Data), in.ContentType, err)
+}
+
+//按请求的Content-Type选择解码，未知的类型使用默认的编解码
+func (server *daprServer) requestCodec(in *common.InvocationEvent) Codec {
+	if codec, ok := server.codecs.Lookup(in.ContentType); ok {
+		return codec
 	}
-	logger.Printf("exec [%s] by (%s) %s error:%v", name, string(in.Data), in.ContentType, realErr)
+	return server.codec
 }
 
-func (server *daprServer) invokeWarpper(mName string, receiver reflect.Value, mtype *methodType) common.ServiceInvocationHandler {
-	return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
-		//1. 构造入参
+//按调用方的accept选择编码，查询参数中的accept优先于metadata
+func (server *daprServer) responseCodec(ctx context.Context, in *common.InvocationEvent) Codec {
+	accept := ""
+	if query, err := url.ParseQuery(in.QueryString); err == nil {
+		accept = query.Get(acceptKey)
+	}
+	if accept == "" {
+		accept = incomingMetadata(ctx, acceptKey)
+	}
+	return server.codecs.Negotiate(accept, server.codec)
+}
 
-		argv := reflect.New(mtype.ArgType.Elem())
-		params := argv.Interface()
-		if err := json.Unmarshal(in.Data, &params); err != nil {
+//按路由分发调用，每次调用时从函数表中查找函数的当前实现
+func (server *daprServer) invokeWarpper(route string) common.ServiceInvocationHandler {
+	return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+		entry, err := server.table.lookup(route)
+		if err != nil {
 			return nil, err
 		}
-
-		if err := validParam(argv); err != nil {
+		info := newInvocationInfo(ctx, route, in)
+		ctx = context.WithValue(ctx, invocationInfoKey{}, info)
+		ctx, cancel := server.withTimeout(ctx, entry, info)
+		defer cancel()
+
+		//调用方没有权限、超过调用方的限流或者并发限制时拒绝调用，函数执行结束后才释放位置
+		if !entry.permission.allow(info.CallerAppID) {
+			entry.stats.reject(func(stats *MethodStats) { stats.Denied++ })
+			return nil, PermissionDenied("%s: caller %q is not allowed", route, info.CallerAppID)
+		}
+		if ctx, err = server.authenticate(ctx, route, entry); err != nil {
+			entry.stats.reject(func(stats *MethodStats) { stats.Denied++ })
+			return nil, err
+		}
+		if err := server.checkRateLimit(ctx, info.CallerAppID, route); err != nil {
+			entry.stats.reject(func(stats *MethodStats) { stats.RateLimited++ })
+			return nil, err
+		}
+		release, err := server.acquire(ctx, route, entry)
+		if err != nil {
+			entry.stats.reject(func(stats *MethodStats) { stats.Rejected++ })
 			return nil, err
 		}
-		//2. 构造出参
-		var replyv reflect.Value
-		if mtype.ReplyType.Kind() == reflect.Interface {
-			//没有确定类型统一为nil
-			replyv = reflect.ValueOf((*interface{})(nil))
+		run := func() invokeResult {
+			defer release()
+			return server.safeInvoke(ctx, route, entry, in)
+		}
+
+		//有deadline时不等待忽略ctx的函数，超时后直接返回
+		var res invokeResult
+		if _, ok := ctx.Deadline(); ok {
+			done := make(chan invokeResult, 1)
+			go func() {
+				done <- run()
+			}()
+			select {
+			case res = <-done:
+			case <-ctx.Done():
+				res.err = fmt.Errorf("%s: %w", route, ctx.Err())
+			}
 		} else {
-			//有确定类型，创建确定类型
-			replyv = reflect.New(mtype.ReplyType.Elem())
-			switch mtype.ReplyType.Elem().Kind() {
-			case reflect.Map:
-				replyv.Elem().Set(reflect.MakeMap(mtype.ReplyType.Elem()))
-			case reflect.Slice:
-				replyv.Elem().Set(reflect.MakeSlice(mtype.ReplyType.Elem(), 0, 0))
+			res = run()
+		}
+		if res.panicked != nil && server.dev && server.repanic {
+			panic(res.panicked)
+		}
+		entry.stats.update(func(stats *MethodStats) {
+			stats.Calls++
+			if res.err != nil {
+				stats.Errors++
 			}
+			if errors.Is(res.err, context.DeadlineExceeded) {
+				stats.Timeouts++
+			}
+		})
+		return res.out, res.err
+	}
+}
+
+//一次调用的结果
+type invokeResult struct {
+	out      *common.Content
+	err      error
+	panicked interface{} //函数中panic的值
+}
+
+//执行调用，函数中的panic不能导致整个进程退出
+func (server *daprServer) safeInvoke(ctx context.Context, route string, entry *methodEntry, in *common.InvocationEvent) (res invokeResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Printf("panic in [%s]: %v\n%s", route, r, debug.Stack())
+			entry.stats.update(func(stats *MethodStats) { stats.Panics++ })
+			res = invokeResult{err: Internal("method %s panicked", route), panicked: r}
 		}
+	}()
+	res.out, res.err = server.invoke(ctx, route, entry, in)
+	return res
+}
 
-		//执行函数
-		function := mtype.method.Func
-		// Invoke the method, providing a new value for the reply.
-		returnValues := function.Call([]reflect.Value{receiver, reflect.ValueOf(ctx), argv, replyv})
-		// The return value for the method is an error.
-		errInter := returnValues[0].Interface()
-		server.logMethodCall(mName, in, errInter)
-		if errInter != nil {
-			return nil, errInter.(error)
+//解码入参、执行函数并编码出参
+func (server *daprServer) invoke(ctx context.Context, route string, entry *methodEntry, in *common.InvocationEvent) (*common.Content, error) {
+	mtype := entry.mtype
+	receiver := entry.service.rcvr
+
+	//1. 构造入参，解码前设置默认值，解码后规范化并校验，函数没有入参时忽略请求的内容
+	var argv reflect.Value
+	if mtype.hasInput() {
+		argv = reflect.New(mtype.ArgType.Elem())
+		//默认值在解码前设置，请求中显式传递的零值不会被覆盖
+		if err := applyDefaults(argv); err != nil {
+			return nil, Internal("%s: apply defaults: %v", route, err)
 		}
-		if replyv.IsNil() {
-			return nil, nil
+		if err := decodeInput(server.requestCodec(in), in.Data, argv.Interface(), entry.decodeMode); err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				return nil, e
+			}
+			return nil, InvalidArgument("decode input: %v", err)
 		}
-		data, err := json.Marshal(replyv.Interface())
-		if err != nil {
+		if err := applyMods(argv); err != nil {
+			return nil, InvalidArgument("decode input: %v", err)
+		}
+
+		if err := server.validParam(argv); err != nil {
+			return nil, server.validationError(ctx, err)
+		}
+		if err := validateInput(ctx, argv.Interface()); err != nil {
 			return nil, err
 		}
-		return &common.Content{
-			Data:        data,
-			ContentType: "application/json",
-		}, nil
+	}
 
+	//2. 依次执行拦截器与函数，出参由函数的形式决定
+	invoke := func(ctx context.Context, in interface{}) (interface{}, error) {
+		argv := reflect.Value{}
+		if mtype.hasInput() {
+			argv = reflect.ValueOf(in)
+			if !argv.IsValid() || argv.Type() != mtype.ArgType {
+				return nil, Internal("%s: interceptor passed %T as input, want %s", route, in, mtype.ArgType)
+			}
+		}
+		replyv, err := mtype.call(ctx, receiver, argv)
+		if err != nil || !replyv.IsValid() || replyv.IsNil() {
+			return nil, err
+		}
+		return replyv.Interface(), nil
+	}
+	interceptors := append(server.interceptors[:len(server.interceptors):len(server.interceptors)], entry.interceptors...)
+	var input interface{}
+	if mtype.hasInput() {
+		input = argv.Interface()
+	}
+	reply, err := chainInterceptors(invoke, entry.info(), interceptors)(ctx, input)
+	server.logMethodCall(route, in, err)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	if err := server.validateReply(route, entry, reply); err != nil {
+		return nil, err
 	}
+	codec := server.responseCodec(ctx, in)
+	data, err := codec.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	return &common.Content{
+		Data:        data,
+		ContentType: codec.ContentType(),
+	}, nil
+}
+
+//为处理函数增加Middleware，最外层将错误转换为Error
+func (server *daprServer) chain(handler common.ServiceInvocationHandler) common.ServiceInvocationHandler {
+	return withErrorModel(withAPIToken(server.apiToken, chainMiddlewares(handler, server.middlewares)))
 }
 
 func (server *daprServer) hook(daprd common.Service) error {
 	if server.daprSvr != nil {
 		return errors.New("dapr has already been hooked")
 	}
-	if server.service == nil {
+	if len(server.services) == 0 {
 		return errors.New("service has no method exported ")
 	}
-	logger.Printf("hook service %s to dapr", server.svcName)
-	svcImpl := server.service
-	for methodName, method := range svcImpl.method {
-		logger.Printf("add method [%s] to invoke\n", methodName)
-
-		err := daprd.AddServiceInvocationHandler(methodName, server.invokeWarpper(methodName, svcImpl.rcvr, method))
-		if err != nil {
-			return fmt.Errorf("add service [%s] error: %v", methodName, err)
+	for _, svcImpl := range server.services {
+		server.logger.Printf("hook service %s to dapr", svcImpl.name)
+		for _, method := range svcImpl.method {
+			server.logger.Printf("add method [%s] to invoke\n", method.route)
+
+			handler := server.invokeWarpper(method.route)
+			err := daprd.AddServiceInvocationHandler(method.route, server.chain(handler))
+			if err != nil {
+				return fmt.Errorf("add service [%s] error: %v", method.route, err)
+			}
 		}
 	}
 
-	//外部可以通过此函数获取函数签名信息
-	daprd.AddServiceInvocationHandler("get_signature", server.invokeSignature)
+	//外部可以通过此函数获取函数签名信息，带有路由前缀的函数组在其前缀下也可以获取
+	for _, route := range server.signatureRoutes() {
+		if err := daprd.AddServiceInvocationHandler(route, server.chain(server.invokeSignature)); err != nil {
+			return fmt.Errorf("add signature [%s] error: %v", route, err)
+		}
+	}
+	if server.admin != nil {
+		if err := daprd.AddServiceInvocationHandler(methodsMethod, server.chain(server.invokeMethods)); err != nil {
+			return fmt.Errorf("add methods [%s] error: %v", methodsMethod, err)
+		}
+	}
 	server.daprSvr = daprd
 	return nil
 }
 
-//设置自定义的Logger
+//设置自定义的Logger，只影响之后创建的服务与客户端
+//Deprecated: 使用WithLogger或者WithClientLogger为每个实例指定Logger
 func SetLogger(loggerImpl *log.Logger) {
-	logger = loggerImpl
+	defaultLogger.Lock()
+	defaultLogger.logger = loggerImpl
+	defaultLogger.Unlock()
+}
+
+//Receiver 注册到同一个dapr服务上的一个函数组
+type Receiver struct {
+	ClassName string      //函数组的名称
+	Svr       interface{} //函数组所在的Struct实例
+	Route     RoutePolicy //调用名称的路由规则，默认直接使用函数名
+	//函数名的命名规则，默认为SnakeCase
+	Naming NamingStrategy
+	//指定个别函数对外暴露的函数名，key为Go的函数名，优先级高于MethodAliaser
+	Aliases map[string]string
+	//严格模式，任何一个导出的函数不符合要求时注册失败
+	Strict bool
+	//个别函数的拦截器，key为对外暴露的函数名，在WithInterceptor添加的拦截器内层执行
+	Interceptors map[string][]Interceptor
+	//允许调用的dapr服务，为空时不限制调用方，与WithPermissionPolicy中同名函数组的配置合并
+	Permissions []Permission
+	//个别函数对调用方JWT的要求，key为对外暴露的函数名，需要通过WithJWT开启JWT认证
+	Auth map[string]AuthRequirement
+
+	funcs []funcHandler //通过Handle注册的函数
 }
 
 //NewServiceWithDapr 启动Dapr服务
 //@address 监听的地址与端口号，格式如下：":2000" 等效于 "0.0.0.0:2000"
 func NewServiceWithDapr(address string, svrType ServerType, className string, svr interface{}) (common.Service, error) {
-	var svc common.Service
-	var err error
-
-	defaultDaprServer := newDaprServer()
-	if err := defaultDaprServer.registMethods(className, svr); err != nil {
-		return nil, err
-	}
-	data, err := defaultDaprServer.getSignatureYaml()
-	if err == nil {
-		logger.Printf("Service method signature\n%s\n", data)
-	}
+	return NewServiceWithDaprReceivers(address, svrType, Receiver{ClassName: className, Svr: svr})
+}
 
-	defaultDaprServer.svrType = svrType
-	if svrType == GRPC {
-		svc, err = dapr_grpc.NewService(address)
-		if err != nil {
-			return nil, err
-		}
-	} else if svrType == HTTP {
-		svc = dapr_http.NewService(address)
-	}
-	err = defaultDaprServer.hook(svc)
+//NewServiceWithDaprReceivers 启动Dapr服务，同一个服务上挂载多个函数组
+//@address 监听的地址与端口号，格式如下：":2000" 等效于 "0.0.0.0:2000"
+func NewServiceWithDaprReceivers(address string, svrType ServerType, receivers ...Receiver) (common.Service, error) {
+	server, err := NewServer(WithAddress(address), WithProtocol(svrType), WithReceivers(receivers...))
 	if err != nil {
-		logger.Panic(err.Error())
+		return nil, err
 	}
-	return svc, nil
+	return server.Service(), nil
 }
 
 //NewService 启动Dapr服务,外部手动创建不同类型的服务(grpc/http)
 func NewService(service common.Service, className string, svr interface{}) error {
+	return NewServiceWithReceivers(service, Receiver{ClassName: className, Svr: svr})
+}
 
-	var err error
-
-	defaultDaprServer := newDaprServer()
-	if err := defaultDaprServer.registMethods(className, svr); err != nil {
-		return err
-	}
-	data, err := defaultDaprServer.getSignatureYaml()
-	if err == nil {
-		logger.Printf("Service method signature\n%s\n", data)
-	}
-
+//NewServiceWithReceivers 启动Dapr服务,外部手动创建不同类型的服务(grpc/http)，同一个服务上挂载多个函数组
+//HTTP服务需要通过NewHTTPService创建，否则读取不到请求头中的metadata，参考WithService
+func NewServiceWithReceivers(service common.Service, receivers ...Receiver) error {
 	if service == nil {
 		return errors.New("service is null")
 	}
-	err = defaultDaprServer.hook(service)
-	if err != nil {
-		logger.Panic(err.Error())
-	}
-	return nil
-}
-
-func GetClient() (client.Client, error) {
-	if defaultClient != nil {
-		return defaultClient, nil
-	}
-	return client.NewClient()
-}
-
-func Invoke(appId, method string, in interface{}, out interface{}) error {
-	c, err := GetClient()
-	if err != nil {
-		return err
-	}
-	data, err := json.Marshal(in)
-	if err != nil {
-		return err
-	}
-	resp, err := c.InvokeMethodWithContent(context.Background(), appId, method, "POST", &client.DataContent{
-		Data:        data,
-		ContentType: "application/json",
-	})
-	logger.Printf("invoke [%s.%s]\n in:`%s` out:`%s` error:%v", appId, method, string(data), string(resp), err)
-	if err != nil {
-		return err
-	}
-	if out == nil {
-		return nil
-	}
-	if err = json.Unmarshal(resp, out); err != nil {
-		return err
-	}
-	return nil
+	_, err := NewServer(WithService(service), WithReceivers(receivers...))
+	return err
 }
@@ -0,0 +1,91 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/dapr/go-sdk/service/common"
+	"google.golang.org/grpc/metadata"
+)
+
+//调用方指定响应编码的metadata或者查询参数
+const acceptKey = "accept"
+
+type headersKey struct{}
+
+//HTTP服务的请求头保存到context中，与gRPC的metadata使用相同的方式读取
+func withHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), headersKey{}, r.Header)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+//incomingMetadata 读取调用方通过dapr传递的metadata，key不区分大小写
+//gRPC服务读取metadata，HTTP服务读取请求头(需要通过NewServer创建)
+func incomingMetadata(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(key); len(vals) > 0 {
+			return vals[0]
+		}
+	}
+	if header, ok := ctx.Value(headersKey{}).(http.Header); ok {
+		return header.Get(key)
+	}
+	return ""
+}
+
+//dapr转发调用方身份的metadata
+const callerAppIDKey = "dapr-caller-app-id"
+
+//dapr转发的链路追踪metadata
+var traceKeys = []string{"traceparent", "tracestate", "grpc-trace-bin"}
+
+//InvocationInfo 一次调用的原始信息，处理函数通过FromContext获取
+type InvocationInfo struct {
+	Method      string            //调用名称
+	Verb        string            //HTTP方法，gRPC调用时由调用方指定
+	QueryString string            //原始的查询参数
+	Query       url.Values        //解析后的查询参数
+	ContentType string            //请求内容的类型
+	CallerAppID string            //调用方的app-id，不经过dapr调用时为空
+	Trace       map[string]string //链路追踪的metadata，如traceparent
+	Data        []byte            //请求的原始内容
+}
+
+type invocationInfoKey struct{}
+
+//根据dapr的调用事件与metadata生成调用信息
+func newInvocationInfo(ctx context.Context, method string, in *common.InvocationEvent) *InvocationInfo {
+	info := &InvocationInfo{
+		Method:      method,
+		Verb:        in.Verb,
+		QueryString: in.QueryString,
+		ContentType: in.ContentType,
+		CallerAppID: incomingMetadata(ctx, callerAppIDKey),
+		Trace:       make(map[string]string),
+		Data:        in.Data,
+	}
+	info.Query, _ = url.ParseQuery(in.QueryString)
+	for _, key := range traceKeys {
+		if val := incomingMetadata(ctx, key); val != "" {
+			info.Trace[key] = val
+		}
+	}
+	return info
+}
+
+//FromContext 获取当前调用的原始信息，不在函数调用中时返回false
+func FromContext(ctx context.Context) (*InvocationInfo, bool) {
+	info, ok := ctx.Value(invocationInfoKey{}).(*InvocationInfo)
+	return info, ok
+}
+
+//CallerAppID 获取调用方的app-id，无法确定时为空
+func CallerAppID(ctx context.Context) string {
+	if info, ok := FromContext(ctx); ok {
+		return info.CallerAppID
+	}
+	return incomingMetadata(ctx, callerAppIDKey)
+}
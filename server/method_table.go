@@ -0,0 +1,174 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dapr/go-sdk/service/common"
+	"gopkg.in/yaml.v3"
+)
+
+//内置的获取函数运行状态的调用名称
+const methodsMethod = "get_methods"
+
+//ErrMethodDisabled 调用了被禁用的函数
+var ErrMethodDisabled = errors.New("method disabled")
+
+//ErrMethodNotFound 函数没有注册
+var ErrMethodNotFound = errors.New("method not found")
+
+//函数表中的一项，创建后不再修改，状态变化时整体替换
+type methodEntry struct {
+	service *service
+	mtype   *methodType
+	stats   *methodStats //复制时共享
+	//函数自己的拦截器，替换实现后继续使用
+	interceptors []Interceptor
+	timeout      time.Duration     //0表示不限制
+	limiter      *limiter          //为nil时不限制并发
+	permission   *methodPermission //为nil时不限制调用方
+	auth         *AuthRequirement  //为nil时不要求JWT
+	decodeMode   DecodeMode
+	disabled     bool
+	replaced     bool
+}
+
+//methodTable 运行时可以修改的函数表，每次调用时按路由查找
+type methodTable struct {
+	sync.RWMutex
+	entries map[string]*methodEntry
+}
+
+func newMethodTable() *methodTable {
+	return &methodTable{entries: make(map[string]*methodEntry)}
+}
+
+func (t *methodTable) add(entry *methodEntry) {
+	t.Lock()
+	defer t.Unlock()
+	entry.stats = &methodStats{}
+	t.entries[entry.mtype.route] = entry
+}
+
+//查找可以调用的函数
+func (t *methodTable) lookup(route string) (*methodEntry, error) {
+	t.RLock()
+	entry, ok := t.entries[route]
+	t.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMethodNotFound, route)
+	}
+	if entry.disabled {
+		return nil, fmt.Errorf("%w: %s", ErrMethodDisabled, route)
+	}
+	return entry, nil
+}
+
+//在锁内复制并修改一项
+func (t *methodTable) update(route string, fn func(entry *methodEntry) error) error {
+	t.Lock()
+	defer t.Unlock()
+	entry, ok := t.entries[route]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrMethodNotFound, route)
+	}
+	copied := *entry
+	if err := fn(&copied); err != nil {
+		return err
+	}
+	t.entries[route] = &copied
+	return nil
+}
+
+//MethodState 函数的运行状态
+type MethodState struct {
+	Route    string      `json:"route" yaml:"route"`
+	Receiver string      `json:"receiver" yaml:"receiver"`
+	Method   string      `json:"method" yaml:"method"` //Go的函数名
+	Disabled bool        `json:"disabled" yaml:"disabled"`
+	Replaced bool        `json:"replaced" yaml:"replaced"` //实现已经在运行时被替换
+	Stats    MethodStats `json:"stats" yaml:"stats"`
+}
+
+//按路由排序的全部函数的状态
+func (t *methodTable) states() []MethodState {
+	t.RLock()
+	defer t.RUnlock()
+	states := make([]MethodState, 0, len(t.entries))
+	for route, entry := range t.entries {
+		states = append(states, MethodState{
+			Route:    route,
+			Receiver: entry.service.name,
+			Method:   entry.mtype.method.Name,
+			Disabled: entry.disabled,
+			Replaced: entry.replaced,
+			Stats:    entry.stats.snapshot(),
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Route < states[j].Route
+	})
+	return states
+}
+
+//DisableMethod 禁用函数，调用时返回ErrMethodDisabled
+func (s *Server) DisableMethod(route string) error {
+	return s.dapr.table.update(route, func(entry *methodEntry) error {
+		entry.disabled = true
+		return nil
+	})
+}
+
+//EnableMethod 重新启用被禁用的函数
+func (s *Server) EnableMethod(route string) error {
+	return s.dapr.table.update(route, func(entry *methodEntry) error {
+		entry.disabled = false
+		return nil
+	})
+}
+
+//ReplaceMethod 在运行时替换函数的实现，不需要重启服务
+//@Param fn 新的实现，支持与注册函数相同的几种形式，入参与出参的类型必须与原函数一致
+func (s *Server) ReplaceMethod(route string, fn interface{}) error {
+	return s.dapr.table.update(route, func(entry *methodEntry) error {
+		mt, err := anyFuncMethod(entry.mtype.method.Name, fn)
+		if err != nil {
+			return err
+		}
+		old := entry.mtype
+		if mt.ArgType != old.ArgType || mt.hasOutput() != old.hasOutput() || (mt.hasOutput() && mt.ReplyType != old.ReplyType) {
+			return fmt.Errorf("%s: implementation must have the same input and output types", route)
+		}
+		mt.route = old.route
+		mt.inFields = old.inFields
+		mt.outFields = old.outFields
+		mt.defaults = old.defaults
+		entry.mtype = mt
+		entry.replaced = true
+		return nil
+	})
+}
+
+//MethodStates 获取全部函数的运行状态与调用统计
+func (s *Server) MethodStates() []MethodState {
+	return s.dapr.table.states()
+}
+
+//在服务中增加一个获取函数运行状态的方法，只允许WithAdminMethods中的调用方调用
+func (server *daprServer) invokeMethods(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+	if caller := CallerAppID(ctx); !server.admin.allow(caller) {
+		return nil, PermissionDenied("%s: caller %q is not allowed", methodsMethod, caller)
+	}
+	data, err := yaml.Marshal(server.table.states())
+	if err != nil {
+		return nil, err
+	}
+	return &common.Content{
+		Data:        data,
+		ContentType: "application/yaml",
+	}, nil
+}
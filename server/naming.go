@@ -0,0 +1,59 @@
+package dapr_sdk_warpper
+
+//NamingStrategy 将Go的函数名转换为对外暴露的函数名
+type NamingStrategy interface {
+	MethodName(goName string) string
+}
+
+//NamingFunc 使用普通函数实现NamingStrategy
+type NamingFunc func(goName string) string
+
+func (f NamingFunc) MethodName(goName string) string {
+	return f(goName)
+}
+
+//内置的命名规则，以GetLoginKind为例
+var (
+	SnakeCase  NamingStrategy = NamingFunc(camelToLowerStyle)      //get_login_kind，默认规则
+	KebabCase  NamingStrategy = NamingFunc(camelToKebabStyle)      //get-login-kind
+	LowerCamel NamingStrategy = NamingFunc(camelToLowerCamelStyle) //getLoginKind
+	Identity   NamingStrategy = NamingFunc(func(goName string) string { return goName })
+)
+
+//MethodAliaser 函数组实现此接口后，可以为个别函数指定对外暴露的函数名
+//返回值的key为Go的函数名，value为对外暴露的函数名，优先级高于NamingStrategy
+//一般用于重构Go代码时保留旧的调用名称
+type MethodAliaser interface {
+	MethodAliases() map[string]string
+}
+
+//函数组用于提供配置的函数，注册时不作为服务函数
+func isReservedMethod(goName string) bool {
+	switch goName {
+	case "MethodAliases", "MethodTimeouts":
+		return true
+	}
+	return false
+}
+
+//组合命名规则与别名，生成函数组的命名函数
+func methodNamer(rcvr interface{}, naming NamingStrategy, aliases map[string]string) func(string) string {
+	if naming == nil {
+		naming = SnakeCase
+	}
+	merged := map[string]string{}
+	if aliaser, ok := rcvr.(MethodAliaser); ok {
+		for goName, name := range aliaser.MethodAliases() {
+			merged[goName] = name
+		}
+	}
+	for goName, name := range aliases {
+		merged[goName] = name
+	}
+	return func(goName string) string {
+		if name, ok := merged[goName]; ok && name != "" {
+			return name
+		}
+		return naming.MethodName(goName)
+	}
+}
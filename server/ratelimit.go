@@ -0,0 +1,245 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dapr/go-sdk/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+//RateLimit 按调用方与函数的令牌桶限流，每个调用方独立计算令牌
+//同一次调用匹配多条规则时，Caller与Method都指定的规则优先，其次是只指定Caller的规则，再次是只指定Method的规则
+type RateLimit struct {
+	Caller string  `json:"caller" yaml:"caller"` //调用方的app-id，为空时匹配全部调用方
+	Method string  `json:"method" yaml:"method"` //函数的调用名称，为空时该调用方的全部函数共享令牌
+	Rate   float64 `json:"rate" yaml:"rate"`     //每秒补充的令牌数
+	Burst  int     `json:"burst" yaml:"burst"`   //令牌桶的容量，为0时等于Rate
+}
+
+func (l RateLimit) check() error {
+	if l.Rate <= 0 || l.Burst < 0 {
+		return fmt.Errorf("invalid rate limit %+v", l)
+	}
+	return nil
+}
+
+//规则的优先级，越大越优先
+func (l RateLimit) priority() int {
+	p := 0
+	if l.Caller != "" {
+		p += 2
+	}
+	if l.Method != "" {
+		p++
+	}
+	return p
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(l.Rate, 1)
+}
+
+//RateLimitConfig 限流配置，可以通过LoadRateLimitConfig从YAML文件加载
+type RateLimitConfig struct {
+	//dapr状态存储的名称，设置后令牌桶保存在状态存储中，多个副本共享限制
+	Store  string      `json:"store" yaml:"store"`
+	Limits []RateLimit `json:"limits" yaml:"limits"`
+	//访问状态存储的dapr客户端，为空时使用默认客户端
+	Client client.Client `json:"-" yaml:"-"`
+}
+
+//LoadRateLimitConfig 从YAML文件加载限流配置
+func LoadRateLimitConfig(path string) (*RateLimitConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &RateLimitConfig{}
+	if err = yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("rate limit %s: %w", path, err)
+	}
+	return config, nil
+}
+
+//令牌桶的状态
+type bucket struct {
+	Tokens float64 `json:"tokens"`
+	Last   int64   `json:"last"` //上次补充令牌的时间，UnixNano
+}
+
+//补充令牌后尝试取出一个令牌
+func (b *bucket) take(limit RateLimit, now time.Time) bool {
+	if b.Last == 0 {
+		b.Tokens = limit.burst()
+	} else if elapsed := now.UnixNano() - b.Last; elapsed > 0 {
+		b.Tokens = math.Min(limit.burst(), b.Tokens+float64(elapsed)/float64(time.Second)*limit.Rate)
+	}
+	b.Last = now.UnixNano()
+	if b.Tokens < 1 {
+		return false
+	}
+	b.Tokens--
+	return true
+}
+
+//保存令牌桶的位置
+type bucketStore interface {
+	take(ctx context.Context, key string, limit RateLimit) (bool, error)
+}
+
+//保存在内存中的令牌桶，只在当前副本生效
+type localBuckets struct {
+	sync.Mutex
+	buckets map[string]*bucket
+}
+
+func (s *localBuckets) take(ctx context.Context, key string, limit RateLimit) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{}
+		s.buckets[key] = b
+	}
+	return b.take(limit, time.Now()), nil
+}
+
+//保存在dapr状态存储中的令牌桶，通过ETag保证多个副本并发修改时的一致性
+type stateBuckets struct {
+	dapr  client.Client
+	store string
+}
+
+//ETag冲突时重试的次数
+const bucketRetries = 3
+
+func (s *stateBuckets) take(ctx context.Context, key string, limit RateLimit) (bool, error) {
+	key = "ratelimit||" + key
+	for i := 0; i < bucketRetries; i++ {
+		item, err := s.dapr.GetState(ctx, s.store, key)
+		if err != nil {
+			return false, err
+		}
+		//键不存在时先创建空的令牌桶，各副本写入的内容相同，已经存在时first-write返回冲突
+		//取出令牌的修改总是携带ETag，不会有两个副本都从满的令牌桶中取出令牌
+		if item == nil || item.Etag == "" {
+			err = s.save(ctx, key, &bucket{}, nil)
+			if err != nil && !etagMismatch(err) {
+				return false, err
+			}
+			continue
+		}
+		b := &bucket{}
+		if len(item.Value) > 0 {
+			if err = json.Unmarshal(item.Value, b); err != nil {
+				return false, err
+			}
+		}
+		allowed := b.take(limit, time.Now())
+		err = s.save(ctx, key, b, &client.ETag{Value: item.Etag})
+		if err == nil {
+			return allowed, nil
+		}
+		if !etagMismatch(err) {
+			return false, err
+		}
+	}
+	return false, errors.New("rate limit: too many concurrent updates of " + key)
+}
+
+func (s *stateBuckets) save(ctx context.Context, key string, b *bucket, etag *client.ETag) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return s.dapr.SaveBulkState(ctx, s.store, &client.SetStateItem{
+		Key:     key,
+		Value:   data,
+		Etag:    etag,
+		Options: &client.StateOptions{Concurrency: client.StateConcurrencyFirstWrite},
+	})
+}
+
+//dapr在ETag不一致时返回Aborted
+func etagMismatch(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	return errors.As(err, &se) && se.GRPCStatus().Code() == codes.Aborted
+}
+
+//按RateLimitConfig限流
+type rateLimiter struct {
+	limits []RateLimit
+	store  bucketStore
+}
+
+func newRateLimiter(config *RateLimitConfig) (*rateLimiter, error) {
+	if config == nil || len(config.Limits) == 0 {
+		return nil, nil
+	}
+	for _, limit := range config.Limits {
+		if err := limit.check(); err != nil {
+			return nil, err
+		}
+	}
+	r := &rateLimiter{limits: config.Limits, store: &localBuckets{buckets: make(map[string]*bucket)}}
+	if config.Store != "" {
+		dapr := config.Client
+		if dapr == nil {
+			var err error
+			if dapr, err = GetClient(); err != nil {
+				return nil, err
+			}
+		}
+		r.store = &stateBuckets{dapr: dapr, store: config.Store}
+	}
+	return r, nil
+}
+
+//匹配优先级最高的规则
+func (r *rateLimiter) match(caller, route string) (int, bool) {
+	found, priority := -1, -1
+	for i, limit := range r.limits {
+		if (limit.Caller == "" || limit.Caller == caller) && (limit.Method == "" || limit.Method == route) && limit.priority() > priority {
+			found, priority = i, limit.priority()
+		}
+	}
+	return found, found >= 0
+}
+
+//取出一个令牌，没有匹配的规则时不限制调用
+func (r *rateLimiter) allow(ctx context.Context, caller, route string) (bool, error) {
+	if r == nil {
+		return true, nil
+	}
+	i, ok := r.match(caller, route)
+	if !ok {
+		return true, nil
+	}
+	limit := r.limits[i]
+	return r.store.take(ctx, fmt.Sprintf("%d|%s|%s", i, caller, limit.Method), limit)
+}
+
+//超过调用方的限流时返回错误，状态存储出错时不限制调用
+func (server *daprServer) checkRateLimit(ctx context.Context, caller, route string) error {
+	allowed, err := server.rateLimiter.allow(ctx, caller, route)
+	if err != nil {
+		server.logger.Printf("rate limit [%s] by (%s): %v", route, caller, err)
+		return nil
+	}
+	if !allowed {
+		return ResourceExhausted("%s: rate limit exceeded for caller %q", route, caller)
+	}
+	return nil
+}
@@ -5,99 +5,230 @@ import (
 	"errors"
 	"fmt"
 	"go/token"
-	"log"
 	"reflect"
 	"strings"
 	"sync"
 )
 
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+var typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// methodShape is the signature form of a registered method.
+type methodShape int
+
+const (
+	shapeInOut    methodShape = iota // func(ctx, *In, *Out) error, *Out may be interface{} for no output
+	shapeInReturn                    // func(ctx, *In) (*Out, error)
+	shapeIn                          // func(ctx, *In) error
+	shapeReturn                      // func(ctx) (*Out, error)
+)
 
 type methodType struct {
 	sync.Mutex // protects counters
 	method     reflect.Method
-	ArgType    reflect.Type
-	ReplyType  reflect.Type
+	ArgType    reflect.Type // nil if the method has no input
+	ReplyType  reflect.Type // nil if the method has no output
+	shape      methodShape
+	fn         reflect.Value     // function registered by Handle, called without receiver
+	route      string            // invocation name on dapr
+	inFields   []refFieldInfo    // signature of the input
+	outFields  []refFieldInfo    // signature of the output
+	defaults   map[string]string // default values of the input by json path
 	numCalls   uint
 }
 
+// hasInput reports whether the method needs a decoded input.
+func (m *methodType) hasInput() bool {
+	return m.ArgType != nil
+}
+
+// hasOutput reports whether the method produces a reply,
+// interface{} reply of the net/rpc style means no output.
+func (m *methodType) hasOutput() bool {
+	return m.ReplyType != nil && m.ReplyType.Kind() != reflect.Interface
+}
+
+// call invokes the method by its shape, argv is ignored if the method has no input.
+// The reply is invalid or nil if the method has no output.
+func (m *methodType) call(ctx context.Context, rcvr reflect.Value, argv reflect.Value) (reflect.Value, error) {
+	function := m.method.Func
+	args := []reflect.Value{rcvr, reflect.ValueOf(ctx)}
+	if m.fn.IsValid() {
+		function = m.fn
+		args = args[1:]
+	}
+	if m.hasInput() {
+		args = append(args, argv)
+	}
+	var replyv reflect.Value
+	if m.shape == shapeInOut {
+		if m.ReplyType.Kind() == reflect.Interface {
+			//没有确定类型统一为nil
+			replyv = reflect.Zero(m.ReplyType)
+		} else {
+			//有确定类型，创建确定类型
+			replyv = reflect.New(m.ReplyType.Elem())
+			switch m.ReplyType.Elem().Kind() {
+			case reflect.Map:
+				replyv.Elem().Set(reflect.MakeMap(m.ReplyType.Elem()))
+			case reflect.Slice:
+				replyv.Elem().Set(reflect.MakeSlice(m.ReplyType.Elem(), 0, 0))
+			}
+		}
+		args = append(args, replyv)
+	}
+
+	returnValues := function.Call(args)
+	// The last return value for the method is an error.
+	errInter := returnValues[len(returnValues)-1].Interface()
+	if errInter != nil {
+		return reflect.Value{}, errInter.(error)
+	}
+	switch m.shape {
+	case shapeInReturn, shapeReturn:
+		replyv = returnValues[0]
+	case shapeIn:
+		replyv = reflect.Value{}
+	}
+	if !m.hasOutput() {
+		return reflect.Value{}, nil
+	}
+	return replyv, nil
+}
+
+// loadFields describes the input and output for the signature.
+func (m *methodType) loadFields() (err error) {
+	m.inFields, m.outFields, err = getMethodFields(m)
+	if err != nil || !m.hasInput() {
+		return err
+	}
+	m.defaults, err = fieldDefaults(m.ArgType)
+	return err
+}
+
 type service struct {
 	name   string                 // name of service
 	rcvr   reflect.Value          // receiver of methods for the service
 	typ    reflect.Type           // type of the receiver
+	route  RoutePolicy            // route policy of the methods
 	method map[string]*methodType // registered methods
+	// callers allowed by method name, nil if callers are not restricted
+	permissions map[string]*methodPermission
+	// token requirements by method name
+	auth map[string]*AuthRequirement
 }
 
-// suitableMethods returns suitable Rpc methods of typ, it will report
-// error using log if reportErr is true.
-func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
+// suitableMethods returns suitable Rpc methods of typ named by nameOf,
+// and every exported method that was skipped with the reason.
+func suitableMethods(typ reflect.Type, nameOf func(string) string) (map[string]*methodType, []RejectedMethod) {
 	methods := make(map[string]*methodType)
+	rejected := []RejectedMethod{}
 	for m := 0; m < typ.NumMethod(); m++ {
 		method := typ.Method(m)
-		mtype := method.Type
-		mname := camelToLowerStyle(method.Name)
+		mname := nameOf(method.Name)
 		// Method must be exported.
-		if method.PkgPath != "" {
+		if method.PkgPath != "" || isReservedMethod(method.Name) {
 			continue
 		}
-		// Method needs three ins: receiver,context, *in, *out
-		if mtype.NumIn() != 4 {
-			if reportErr {
-				log.Printf("rpc.Register: method %q has %d input parameters; needs exactly Four\n", mname, mtype.NumIn())
-			}
+		reject := func(reason RejectReason, detail string) {
+			rejected = append(rejected, RejectedMethod{
+				Method: method.Name,
+				Name:   mname,
+				Reason: reason,
+				Detail: detail,
+			})
+		}
+		mt, reason, detail := parseMethodType(method.Type, 1)
+		if mt == nil {
+			reject(reason, detail)
 			continue
 		}
-		//context
-
-		fistType := mtype.In(1)
-		ctxType := reflect.TypeOf((*context.Context)(nil)).Elem()
-		if fistType != ctxType {
-			if reportErr {
-				log.Printf("rpc.Register: first argument must be a pointer method %q is not exported: %q\n", mname, fistType)
-			}
+		if _, ok := methods[mname]; ok {
+			reject(RejectDuplicated, fmt.Sprintf("name %q is duplicated", mname))
 			continue
 		}
+		mt.method = method
+		// In and out must be described by the signature.
+		if err := mt.loadFields(); err != nil {
+			reject(RejectUnsupportedField, err.Error())
+			continue
+		}
+		methods[mname] = mt
+	}
+	return methods, rejected
+}
 
+// parseMethodType checks the shape of a method or function type, skip is the
+// number of parameters before context, 1 for the receiver of a method.
+// Accepted shapes are:
+//	func(ctx, *In, *Out) error
+//	func(ctx, *In) (*Out, error)
+//	func(ctx, *In) error
+//	func(ctx) (*Out, error)
+func parseMethodType(mtype reflect.Type, skip int) (*methodType, RejectReason, string) {
+	numIn := mtype.NumIn() - skip
+	// Method needs context, at most *in and *out
+	if numIn < 1 || numIn > 3 {
+		return nil, RejectArity, fmt.Sprintf("has %d input parameters; needs one to three", numIn)
+	}
+	// Method needs one or two outs.
+	if mtype.NumOut() != 1 && mtype.NumOut() != 2 {
+		return nil, RejectArity, fmt.Sprintf("has %d output parameters; needs one or two", mtype.NumOut())
+	}
+	//context
+	fistType := mtype.In(skip)
+	if fistType != typeOfContext {
+		return nil, RejectContext, fmt.Sprintf("first argument must be context.Context: %q", fistType)
+	}
+
+	var shape methodShape
+	switch {
+	case numIn == 3 && mtype.NumOut() == 1:
+		shape = shapeInOut
+	case numIn == 2 && mtype.NumOut() == 2:
+		shape = shapeInReturn
+	case numIn == 2 && mtype.NumOut() == 1:
+		shape = shapeIn
+	case numIn == 1 && mtype.NumOut() == 2:
+		shape = shapeReturn
+	default:
+		return nil, RejectArity, fmt.Sprintf("has %d input and %d output parameters; unsupported shape", numIn, mtype.NumOut())
+	}
+
+	var argType, replyType reflect.Type
+	if shape != shapeReturn {
 		// In arg must be a pointer.
-		argType := mtype.In(2)
-		if argType.Kind() != reflect.Ptr || !isExportedOrBuiltinType(argType) {
-			if reportErr {
-				log.Printf("rpc.Register: argument type of method %q is not exported: %q\n", mname, argType)
-			}
-			continue
+		argType = mtype.In(skip + 1)
+		if argType.Kind() != reflect.Ptr {
+			return nil, RejectNotPointer, fmt.Sprintf("argument type is not a pointer: %q", argType)
+		}
+		if !isExportedOrBuiltinType(argType) {
+			return nil, RejectUnexportedType, fmt.Sprintf("argument type is not exported: %q", argType)
 		}
+	}
+	switch shape {
+	case shapeInOut:
 		// Out arg must be a pointer. 参数可以为interface{}或者指针
-		replyType := mtype.In(3)
+		replyType = mtype.In(skip + 2)
 		if replyType.Kind() != reflect.Ptr && replyType.Kind() != reflect.Interface {
-			if reportErr {
-				log.Printf("rpc.Register: reply type of method %q is not a pointer: %q\n", mname, replyType)
-			}
-			continue
-		}
-		// Reply type must be exported.
-		if !isExportedOrBuiltinType(replyType) {
-			if reportErr {
-				log.Printf("rpc.Register: reply type of method %q is not exported: %q\n", mname, replyType)
-			}
-			continue
-		}
-		// Method needs one out.
-		if mtype.NumOut() != 1 {
-			if reportErr {
-				log.Printf("rpc.Register: method %q has %d output parameters; needs exactly one\n", mname, mtype.NumOut())
-			}
-			continue
+			return nil, RejectNotPointer, fmt.Sprintf("reply type is not a pointer: %q", replyType)
 		}
-		// The return type of the method must be error.
-		if returnType := mtype.Out(0); returnType != typeOfError {
-			if reportErr {
-				log.Printf("rpc.Register: return type of method %q is %q, must be error\n", mname, returnType)
-			}
-			continue
+	case shapeInReturn, shapeReturn:
+		// Returned reply must be a pointer.
+		replyType = mtype.Out(0)
+		if replyType.Kind() != reflect.Ptr {
+			return nil, RejectNotPointer, fmt.Sprintf("reply type is not a pointer: %q", replyType)
 		}
-		methods[mname] = &methodType{method: method, ArgType: argType, ReplyType: replyType}
 	}
-	return methods
+	// Reply type must be exported.
+	if replyType != nil && !isExportedOrBuiltinType(replyType) {
+		return nil, RejectUnexportedType, fmt.Sprintf("reply type is not exported: %q", replyType)
+	}
+	// The last return type of the method must be error.
+	if returnType := mtype.Out(mtype.NumOut() - 1); returnType != typeOfError {
+		return nil, RejectBadReturn, fmt.Sprintf("return type is %q, must be error", returnType)
+	}
+	return &methodType{ArgType: argType, ReplyType: replyType, shape: shape}, "", ""
 }
 
 // Is this type exported or a builtin?
@@ -172,9 +303,12 @@ func structToYaml(inst interface{}) ([]refFieldInfo, error) {
 		jsonTypeName := getJsonDataType(field.Type)
 		isSimpleType := jsonTypeName != ""
 		if field.Anonymous {
+			if indirectType(field.Type).Kind() != reflect.Struct {
+				continue
+			}
 			ret, err := structToYaml(srcValue.Field(m).Addr().Interface())
 			if err != nil {
-				continue
+				return nil, err
 			}
 			fieldInfoList = append(fieldInfoList, ret...)
 			continue
@@ -188,8 +322,7 @@ func structToYaml(inst interface{}) ([]refFieldInfo, error) {
 		}
 		//2022-04-21 增加对时间类型支持
 		if field.Type.Name() == "Time" {
-			log.Panicf("not support time.Time use 'JSONTime'")
-			continue
+			return nil, fmt.Errorf("field %s.%s: not support time.Time use 'JSONTime'", srcType.Name(), field.Name)
 		}
 
 		if field.Type.Name() == "JSONTime" {
@@ -206,7 +339,7 @@ func structToYaml(inst interface{}) ([]refFieldInfo, error) {
 		if fieldType.Kind() == reflect.Struct {
 			ret, err := structToYaml(srcValue.Field(m).Addr().Interface())
 			if err != nil {
-				continue
+				return nil, err
 			}
 			fieldInfo[fieldName] = ret
 			fieldInfoList = append(fieldInfoList, fieldInfo)
@@ -216,10 +349,11 @@ func structToYaml(inst interface{}) ([]refFieldInfo, error) {
 		//数组
 		if fieldType.Kind() == reflect.Array || fieldType.Kind() == reflect.Slice {
 			fieldType = fieldType.Elem()
-			if fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Struct {
+			if fieldType.Kind() == reflect.Ptr {
 				fieldType = indirectType(fieldType) //fix: 引用错误，不能用Elem
+			}
+			if fieldType.Kind() == reflect.Struct {
 				//递归对象检查
-				fmt.Printf("%s %s\n", srcType.Name(), fieldType.Name())
 				if srcType.Name() == fieldType.Name() {
 					fieldInfo[fieldName] = []refFieldInfo{} //fix: 这里应当再加一层数组，用于表示field是个数组
 					fieldInfoList = append(fieldInfoList, fieldInfo)
@@ -229,7 +363,7 @@ func structToYaml(inst interface{}) ([]refFieldInfo, error) {
 				ptr := reflect.New(fieldType).Elem()
 				ret, err := structToYaml(ptr.Addr().Interface())
 				if err != nil {
-					continue
+					return nil, err
 				}
 				fieldInfo[fieldName] = [][]refFieldInfo{ret} //fix: 这里应当再加一层数组，用于表示field是个数组
 				fieldInfoList = append(fieldInfoList, fieldInfo)
@@ -246,7 +380,7 @@ func structToYaml(inst interface{}) ([]refFieldInfo, error) {
 		if fieldType.Kind() == reflect.Map {
 			fieldType = fieldType.Elem()
 			if fieldType.Kind() != reflect.String {
-				log.Fatalf("param not support lazy bind map, must be map[string]string")
+				return nil, fmt.Errorf("field %s.%s: param not support lazy bind map, must be map[string]string", srcType.Name(), field.Name)
 			}
 			fieldInfo[fieldName] = map[string]string{"string": "string"}
 			fieldInfoList = append(fieldInfoList, fieldInfo)
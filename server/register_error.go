@@ -0,0 +1,68 @@
+package dapr_sdk_warpper
+
+import (
+	"fmt"
+	"strings"
+)
+
+//RejectReason 函数未能注册的原因，可用于程序判断
+type RejectReason string
+
+const (
+	RejectArity            RejectReason = "wrong_arity"           //入参或者出参的数量不正确
+	RejectContext          RejectReason = "non_context_first_arg" //第一个参数不是context.Context
+	RejectNotPointer       RejectReason = "not_pointer"           //入参或者出参不是指针
+	RejectUnexportedType   RejectReason = "unexported_type"       //入参或者出参的类型没有导出
+	RejectBadReturn        RejectReason = "bad_return"            //最后一个返回值不是error
+	RejectDuplicated       RejectReason = "duplicated_name"       //对外暴露的函数名重复
+	RejectRouteConflict    RejectReason = "route_conflict"        //调用名称与其他函数组冲突
+	RejectUnsupportedField RejectReason = "unsupported_field"     //入参或者出参中有不支持的字段类型
+	RejectReservedRoute    RejectReason = "reserved_route"        //调用名称与内置的get_methods或者get_signature冲突
+	RejectEmptyName        RejectReason = "empty_name"            //Handle注册的函数名为空
+	RejectNilFunc          RejectReason = "nil_func"              //Handle注册的函数为nil
+)
+
+//RejectedMethod 一个未能注册的函数
+type RejectedMethod struct {
+	Method string       //Go的函数名
+	Name   string       //对外暴露的函数名
+	Reason RejectReason //未能注册的原因
+	Detail string       //详细的说明
+}
+
+func (m RejectedMethod) String() string {
+	return fmt.Sprintf("%s(%s): %s, %s", m.Method, m.Name, m.Reason, m.Detail)
+}
+
+//RegistrationError 函数组注册失败，列出全部未能注册的函数
+type RegistrationError struct {
+	ClassName string           //函数组的名称
+	Cause     string           //函数组整体的失败原因，为空时表示由Rejected导致失败
+	Rejected  []RejectedMethod //未能注册的函数
+}
+
+func (e *RegistrationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("register ")
+	sb.WriteString(e.ClassName)
+	sb.WriteString(" failed")
+	if e.Cause != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Cause)
+	}
+	for _, m := range e.Rejected {
+		sb.WriteString("\n\t")
+		sb.WriteString(m.String())
+	}
+	return sb.String()
+}
+
+//HasReason 判断是否有函数因为指定的原因未能注册
+func (e *RegistrationError) HasReason(reason RejectReason) bool {
+	for _, m := range e.Rejected {
+		if m.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
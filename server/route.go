@@ -0,0 +1,48 @@
+package dapr_sdk_warpper
+
+import (
+	"strings"
+)
+
+//内置的获取函数签名的调用名称
+const signatureMethod = "get_signature"
+
+//RoutePolicy 调用名称的路由规则，在函数名前增加前缀与版本段
+//例如 Prefix: "demo", Version: "v1" 时，函数echo的调用名称为 "demo/v1/echo"
+//零值表示不加任何前缀，直接使用函数名
+type RoutePolicy struct {
+	Prefix       string //固定前缀
+	UseClassName bool   //使用函数组名称(className)作为前缀，位于Prefix之后
+	Version      string //版本段，位于函数名之前
+	Separator    string //各段之间的分隔符，默认为"/"
+}
+
+//Route 根据路由规则生成函数的调用名称
+func (p RoutePolicy) Route(className, method string) string {
+	sep := p.Separator
+	if sep == "" {
+		sep = "/"
+	}
+	segments := []string{}
+	for _, seg := range []string{p.Prefix, p.className(className), p.Version} {
+		seg = strings.Trim(seg, sep)
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return strings.Join(append(segments, method), sep)
+}
+
+func (p RoutePolicy) className(className string) string {
+	if !p.UseClassName {
+		return ""
+	}
+	return className
+}
+
+//Invoke 按照相同的路由规则调用其他服务的函数
+//@Param className 对方函数组的名称，UseClassName为false时可以为空
+//@Param method 函数名，例如"echo"
+func (p RoutePolicy) Invoke(appId, className, method string, in interface{}, out interface{}) error {
+	return Invoke(appId, p.Route(className, method), in, out)
+}
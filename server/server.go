@@ -0,0 +1,673 @@
+package dapr_sdk_warpper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dapr/go-sdk/service/common"
+	dapr_grpc "github.com/dapr/go-sdk/service/grpc"
+	dapr_http "github.com/dapr/go-sdk/service/http"
+	ut "github.com/go-playground/universal-translator"
+	validator "github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+//Middleware 包装dapr的调用处理函数，先添加的Middleware位于外层
+type Middleware func(next common.ServiceInvocationHandler) common.ServiceInvocationHandler
+
+func chainMiddlewares(handler common.ServiceInvocationHandler, middlewares []Middleware) common.ServiceInvocationHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+//NewServer的配置
+type serverOptions struct {
+	address      string
+	protocol     ServerType
+	service      common.Service
+	logger       *log.Logger
+	validator    *validator.Validate
+	codec        Codec
+	validations  []validation
+	codecs       []Codec
+	middlewares  []Middleware
+	interceptors []Interceptor
+	receivers    []Receiver
+	dev          bool
+	timeout      time.Duration
+	timeouts     map[string]time.Duration
+	limit        ConcurrencyLimit
+	limits       map[string]ConcurrencyLimit
+	rateLimit    *RateLimitConfig
+	permissions  PermissionPolicy
+	admin        *methodPermission
+	apiToken     string
+	jwt          *JWTConfig
+	repanic      bool
+	checkReply   bool
+	decodeMode   DecodeMode
+	decodeModes  map[string]DecodeMode
+}
+
+//Option NewServer的配置项
+type Option func(opts *serverOptions) error
+
+//WithAddress 监听的地址与端口号，格式如下：":2000" 等效于 "0.0.0.0:2000"
+func WithAddress(address string) Option {
+	return func(opts *serverOptions) error {
+		if address == "" {
+			return errors.New("address is empty")
+		}
+		opts.address = address
+		return nil
+	}
+}
+
+//WithProtocol 服务的协议，GRPC或者HTTP，默认为GRPC
+func WithProtocol(protocol ServerType) Option {
+	return func(opts *serverOptions) error {
+		if protocol != GRPC && protocol != HTTP {
+			return fmt.Errorf("invalid protocol %d", protocol)
+		}
+		opts.protocol = protocol
+		return nil
+	}
+}
+
+//WithService 使用外部创建的dapr服务，设置后忽略WithAddress与WithProtocol
+//HTTP服务需要通过NewHTTPService创建才能读取请求头中的metadata，否则dapr-api-token、调用方的app-id、
+//authorization、accept-language与timeout都读取不到，此时设置WithAppAPIToken、权限或者WithJWT会返回错误
+func WithService(service common.Service) Option {
+	return func(opts *serverOptions) error {
+		if service == nil {
+			return errors.New("service is null")
+		}
+		opts.service = service
+		return nil
+	}
+}
+
+//WithLogger 设置服务使用的Logger
+func WithLogger(logger *log.Logger) Option {
+	return func(opts *serverOptions) error {
+		if logger == nil {
+			return errors.New("logger is null")
+		}
+		opts.logger = logger
+		return nil
+	}
+}
+
+//WithValidator 设置入参校验使用的Validator，默认使用"binding"标签
+//Validator会注册json标签作为字段名，以及中文与英文的错误信息
+func WithValidator(v *validator.Validate) Option {
+	return func(opts *serverOptions) error {
+		if v == nil {
+			return errors.New("validator is null")
+		}
+		opts.validator = v
+		return nil
+	}
+}
+
+//WithValidatorTag 使用指定标签的Validator进行入参校验
+func WithValidatorTag(tag string) Option {
+	return func(opts *serverOptions) error {
+		if tag == "" {
+			return errors.New("validator tag is empty")
+		}
+		v := validator.New()
+		v.SetTagName(tag)
+		opts.validator = v
+		return nil
+	}
+}
+
+//WithValidationRule 注册自定义的校验规则，如mobile_cn、id_card
+//@Param messages 校验错误的翻译，key为语言("zh"或者"en")，{0}为字段名，{1}为校验规则的参数
+func WithValidationRule(tag string, fn validator.Func, messages map[string]string) Option {
+	return func(opts *serverOptions) error {
+		if tag == "" || fn == nil {
+			return errors.New("validation rule is empty")
+		}
+		opts.validations = append(opts.validations, func(v *validator.Validate, uni *ut.UniversalTranslator) error {
+			if err := v.RegisterValidation(tag, fn); err != nil {
+				return err
+			}
+			return registerMessages(v, uni, tag, messages)
+		})
+		return nil
+	}
+}
+
+//WithValidationAlias 注册校验规则的别名，如"adult"表示"min=18"
+//@Param messages 校验错误的翻译，格式与WithValidationRule一致
+func WithValidationAlias(alias, tags string, messages map[string]string) Option {
+	return func(opts *serverOptions) error {
+		if alias == "" || tags == "" {
+			return errors.New("validation alias is empty")
+		}
+		opts.validations = append(opts.validations, func(v *validator.Validate, uni *ut.UniversalTranslator) error {
+			v.RegisterAlias(alias, tags)
+			return registerMessages(v, uni, alias, messages)
+		})
+		return nil
+	}
+}
+
+//WithStructValidation 注册Struct级别的校验，用于字段之间的校验，如两次输入的密码一致
+//@Param types 使用此校验的Struct的实例
+func WithStructValidation(fn validator.StructLevelFunc, types ...interface{}) Option {
+	return func(opts *serverOptions) error {
+		if fn == nil || len(types) == 0 {
+			return errors.New("struct validation is empty")
+		}
+		opts.validations = append(opts.validations, func(v *validator.Validate, uni *ut.UniversalTranslator) error {
+			v.RegisterStructValidation(fn, types...)
+			return nil
+		})
+		return nil
+	}
+}
+
+//WithCodec 设置默认的编解码，默认为JSON
+//请求按Content-Type选择编解码，响应按调用方的accept选择编解码，无法确定时使用默认的编解码
+func WithCodec(codec Codec) Option {
+	return func(opts *serverOptions) error {
+		if codec == nil {
+			return errors.New("codec is null")
+		}
+		opts.codec = codec
+		return nil
+	}
+}
+
+//WithCodecs 注册内置以外的编解码，用于按Content-Type与accept选择
+func WithCodecs(codecs ...Codec) Option {
+	return func(opts *serverOptions) error {
+		for _, codec := range codecs {
+			if codec == nil {
+				return errors.New("codec is null")
+			}
+		}
+		opts.codecs = append(opts.codecs, codecs...)
+		return nil
+	}
+}
+
+//WithMiddleware 为全部函数增加Middleware，按添加的顺序由外向内执行
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(opts *serverOptions) error {
+		for _, m := range middlewares {
+			if m == nil {
+				return errors.New("middleware is null")
+			}
+		}
+		opts.middlewares = append(opts.middlewares, middlewares...)
+		return nil
+	}
+}
+
+//WithInterceptor 为全部函数增加拦截器，按添加的顺序由外向内执行，位于Receiver.Interceptors的外层
+func WithInterceptor(interceptors ...Interceptor) Option {
+	return func(opts *serverOptions) error {
+		for _, interceptor := range interceptors {
+			if interceptor == nil {
+				return errors.New("interceptor is null")
+			}
+		}
+		opts.interceptors = append(opts.interceptors, interceptors...)
+		return nil
+	}
+}
+
+//WithTimeout 函数默认的超时时间，默认不限制
+//超时后调用方收到DeadlineExceeded错误，即使函数没有响应ctx的取消
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *serverOptions) error {
+		if timeout < 0 {
+			return errors.New("timeout is negative")
+		}
+		opts.timeout = timeout
+		return nil
+	}
+}
+
+//WithMethodTimeout 指定个别函数的超时时间，优先级高于MethodTimeouter，0表示不限制
+//@Param route 函数的调用名称
+func WithMethodTimeout(route string, timeout time.Duration) Option {
+	return func(opts *serverOptions) error {
+		if timeout < 0 {
+			return errors.New("timeout is negative")
+		}
+		if opts.timeouts == nil {
+			opts.timeouts = make(map[string]time.Duration)
+		}
+		opts.timeouts[route] = timeout
+		return nil
+	}
+}
+
+//WithConcurrency 全部函数共享的并发限制，默认不限制
+func WithConcurrency(limit ConcurrencyLimit) Option {
+	return func(opts *serverOptions) error {
+		if err := limit.check(); err != nil {
+			return err
+		}
+		opts.limit = limit
+		return nil
+	}
+}
+
+//WithMethodConcurrency 指定个别函数的并发限制，与WithConcurrency同时生效
+//@Param route 函数的调用名称
+func WithMethodConcurrency(route string, limit ConcurrencyLimit) Option {
+	return func(opts *serverOptions) error {
+		if err := limit.check(); err != nil {
+			return err
+		}
+		if opts.limits == nil {
+			opts.limits = make(map[string]ConcurrencyLimit)
+		}
+		opts.limits[route] = limit
+		return nil
+	}
+}
+
+//WithRateLimit 按调用方的app-id与函数限流，超过限制时返回ResourceExhausted错误(HTTP状态码429)
+//调用方的app-id由dapr通过metadata传递，不经过dapr的调用按空的app-id计算
+//令牌桶按app-id区分，app-id可以被伪造，配置限流时必须通过WithAppAPIToken校验调用来自dapr，否则NewServer返回错误
+func WithRateLimit(config RateLimitConfig) Option {
+	return func(opts *serverOptions) error {
+		for _, limit := range config.Limits {
+			if err := limit.check(); err != nil {
+				return err
+			}
+		}
+		opts.rateLimit = &config
+		return nil
+	}
+}
+
+//WithRateLimitFile 从YAML文件加载限流配置，格式与RateLimitConfig一致
+func WithRateLimitFile(path string) Option {
+	return func(opts *serverOptions) error {
+		config, err := LoadRateLimitConfig(path)
+		if err != nil {
+			return err
+		}
+		return WithRateLimit(*config)(opts)
+	}
+}
+
+//WithPermissionPolicy 按函数组的名称配置允许调用的dapr服务，没有权限的调用返回PermissionDenied错误
+//调用方的app-id由dapr通过metadata传递，配置了权限的函数拒绝不经过dapr的调用
+//app-id可以被伪造，配置权限时必须通过WithAppAPIToken校验调用来自dapr，否则NewServer返回错误
+func WithPermissionPolicy(policy PermissionPolicy) Option {
+	return func(opts *serverOptions) error {
+		if opts.permissions == nil {
+			opts.permissions = PermissionPolicy{}
+		}
+		for className, permissions := range policy {
+			opts.permissions[className] = append(opts.permissions[className], permissions...)
+		}
+		return nil
+	}
+}
+
+//WithAdminMethods 开启内置的get_methods函数，返回全部函数的运行状态与调用统计，只允许callers中的dapr服务调用
+//调用方的app-id可以被伪造，开启时必须通过WithAppAPIToken校验调用来自dapr，否则NewServer返回错误
+func WithAdminMethods(callers ...string) Option {
+	return func(opts *serverOptions) error {
+		if len(callers) == 0 {
+			return errors.New("admin methods require at least one caller")
+		}
+		opts.admin = &methodPermission{Callers: callers}
+		return nil
+	}
+}
+
+//WithPermissionFile 从YAML文件加载调用权限，格式见PermissionPolicy
+func WithPermissionFile(path string) Option {
+	return func(opts *serverOptions) error {
+		policy, err := LoadPermissionPolicy(path)
+		if err != nil {
+			return err
+		}
+		return WithPermissionPolicy(policy)(opts)
+	}
+}
+
+//WithAppAPIToken 校验dapr调用时携带的dapr-api-token，与dapr的APP_API_TOKEN一致
+//包括get_signature在内的全部调用都需要携带，不一致时返回Unauthenticated错误
+func WithAppAPIToken(token string) Option {
+	return func(opts *serverOptions) error {
+		if token == "" {
+			return errors.New("api token is empty")
+		}
+		opts.apiToken = token
+		return nil
+	}
+}
+
+//WithAppAPITokenFromEnv 从环境变量APP_API_TOKEN读取token，没有设置时不校验
+func WithAppAPITokenFromEnv() Option {
+	return func(opts *serverOptions) error {
+		opts.apiToken = os.Getenv(appAPITokenEnv)
+		return nil
+	}
+}
+
+//WithAppAPITokenFile 从文件读取token，一般用于挂载的Secret
+func WithAppAPITokenFile(path string) Option {
+	return func(opts *serverOptions) error {
+		token, err := readTokenFile(path)
+		if err != nil {
+			return err
+		}
+		opts.apiToken = token
+		return nil
+	}
+}
+
+//WithJWT 校验调用方通过authorization携带的JWT，声明可以通过ClaimsFromContext获取
+//token无效时返回Unauthenticated错误，不满足函数的AuthRequirement时返回PermissionDenied错误
+func WithJWT(config JWTConfig) Option {
+	return func(opts *serverOptions) error {
+		opts.jwt = &config
+		return nil
+	}
+}
+
+//WithDevelopment 开发模式，开发模式下一些错误会更早地暴露出来
+func WithDevelopment(enabled bool) Option {
+	return func(opts *serverOptions) error {
+		opts.dev = enabled
+		return nil
+	}
+}
+
+//WithRepanic 函数中的panic默认被恢复并返回内部错误，开启后在开发模式下会重新抛出
+func WithRepanic(enabled bool) Option {
+	return func(opts *serverOptions) error {
+		opts.repanic = enabled
+		return nil
+	}
+}
+
+//WithReplyValidation 使用入参的校验规则同样校验函数的出参
+//开发模式下出参没有通过校验时返回内部错误，否则只记录日志并在统计中计数
+func WithReplyValidation(enabled bool) Option {
+	return func(opts *serverOptions) error {
+		opts.checkReply = enabled
+		return nil
+	}
+}
+
+//WithDecodeMode 全部函数入参的解码模式，默认忽略未知的字段
+func WithDecodeMode(mode DecodeMode) Option {
+	return func(opts *serverOptions) error {
+		if err := mode.check(); err != nil {
+			return err
+		}
+		opts.decodeMode = mode
+		return nil
+	}
+}
+
+//WithMethodDecodeMode 指定个别函数入参的解码模式，优先级高于WithDecodeMode
+//@Param route 函数的调用名称
+func WithMethodDecodeMode(route string, mode DecodeMode) Option {
+	return func(opts *serverOptions) error {
+		if err := mode.check(); err != nil {
+			return err
+		}
+		if opts.decodeModes == nil {
+			opts.decodeModes = make(map[string]DecodeMode)
+		}
+		opts.decodeModes[route] = mode
+		return nil
+	}
+}
+
+//WithReceiver 注册一个函数组
+//@Param className 函数组的名称
+//@Param svr 函数组所在的Struct实例
+func WithReceiver(className string, svr interface{}) Option {
+	return WithReceivers(Receiver{ClassName: className, Svr: svr})
+}
+
+//WithReceivers 按顺序注册多个函数组
+func WithReceivers(receivers ...Receiver) Option {
+	return func(opts *serverOptions) error {
+		opts.receivers = append(opts.receivers, receivers...)
+		return nil
+	}
+}
+
+//Server 挂载了函数组的dapr服务
+type Server struct {
+	svc  common.Service
+	dapr *daprServer
+}
+
+//NewServer 按配置创建dapr服务并注册全部函数组，出错时返回错误而不是panic
+func NewServer(opts ...Option) (*Server, error) {
+	o := &serverOptions{protocol: GRPC}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.receivers) == 0 {
+		return nil, errors.New("no receiver to register")
+	}
+	if err := o.checkHeaders(); err != nil {
+		return nil, err
+	}
+	if err := o.checkCallerID(); err != nil {
+		return nil, err
+	}
+
+	server := newDaprServer()
+	if o.logger != nil {
+		server.logger = o.logger
+	}
+	if o.validator != nil {
+		if err := server.setValidator(o.validator); err != nil {
+			return nil, err
+		}
+	}
+	for _, apply := range o.validations {
+		if err := apply(server.validate, server.translators); err != nil {
+			return nil, err
+		}
+	}
+	for _, codec := range o.codecs {
+		server.codecs.Register(codec)
+	}
+	if o.codec != nil {
+		server.codec = o.codec
+		server.codecs.Register(o.codec)
+	}
+	server.middlewares = o.middlewares
+	server.interceptors = o.interceptors
+	server.dev = o.dev
+	server.repanic = o.repanic
+	server.checkReply = o.checkReply
+	server.decodeMode = o.decodeMode
+	server.decodeModes = o.decodeModes
+	server.timeout = o.timeout
+	server.timeouts = o.timeouts
+	server.limiter = newLimiter(o.limit)
+	server.limits = o.limits
+	rateLimiter, err := newRateLimiter(o.rateLimit)
+	if err != nil {
+		return nil, err
+	}
+	server.rateLimiter = rateLimiter
+	server.permissions = o.permissions
+	server.admin = o.admin
+	server.apiToken = o.apiToken
+	if server.jwt, err = newJWTVerifier(o.jwt); err != nil {
+		return nil, err
+	}
+	for _, r := range o.receivers {
+		if err := server.registReceiver(r); err != nil {
+			return nil, err
+		}
+	}
+	for route := range o.timeouts {
+		if _, err := server.table.lookup(route); err != nil {
+			return nil, fmt.Errorf("timeout: %w", err)
+		}
+	}
+	for className := range o.permissions {
+		if server.findService(className) == nil {
+			return nil, fmt.Errorf("permission for unknown receiver %s", className)
+		}
+	}
+	for route := range o.decodeModes {
+		if _, err := server.table.lookup(route); err != nil {
+			return nil, fmt.Errorf("decode mode: %w", err)
+		}
+	}
+	for route := range o.limits {
+		if _, err := server.table.lookup(route); err != nil {
+			return nil, fmt.Errorf("concurrency limit: %w", err)
+		}
+	}
+	if o.rateLimit != nil {
+		for _, limit := range o.rateLimit.Limits {
+			if limit.Method == "" {
+				continue
+			}
+			if _, err := server.table.lookup(limit.Method); err != nil {
+				return nil, fmt.Errorf("rate limit: %w", err)
+			}
+		}
+	}
+	data, err := server.getSignatureYaml()
+	if err == nil {
+		server.logger.Printf("Service method signature\n%s\n", data)
+	}
+
+	svc := o.service
+	if svc == nil {
+		svc, err = newDaprService(o.address, o.protocol)
+		if err != nil {
+			return nil, err
+		}
+	}
+	server.svrType = o.protocol
+	if err = server.hook(svc); err != nil {
+		return nil, err
+	}
+	return &Server{svc: svc, dapr: server}, nil
+}
+
+//按协议创建dapr服务
+func newDaprService(address string, protocol ServerType) (common.Service, error) {
+	if address == "" {
+		return nil, errors.New("address is empty")
+	}
+	switch protocol {
+	case GRPC:
+		return dapr_grpc.NewService(address)
+	case HTTP:
+		return NewHTTPService(address), nil
+	}
+	return nil, fmt.Errorf("invalid protocol %d", protocol)
+}
+
+//NewHTTPService 创建HTTP协议的dapr服务，通过WithService传入NewServer时可以读取请求头中的metadata
+func NewHTTPService(address string) common.Service {
+	router := NewHTTPRouter()
+	return &httpService{Service: dapr_http.NewServiceWithMux(address, router), router: router}
+}
+
+//NewHTTPService创建的服务
+type httpService struct {
+	common.Service
+	router *mux.Router
+}
+
+//外部通过dapr_http创建的HTTP服务无法确认是否使用了NewHTTPRouter，依赖请求头的配置会静默失效，因此拒绝
+func (o *serverOptions) checkHeaders() error {
+	if _, ok := o.service.(*dapr_http.Server); !ok {
+		return nil
+	}
+	var options []string
+	if o.apiToken != "" {
+		options = append(options, "app api token")
+	}
+	if o.jwt != nil {
+		options = append(options, "jwt")
+	}
+	if o.hasPermissions() {
+		options = append(options, "permissions")
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s require reading request headers, create the http service with NewHTTPService", strings.Join(options, ", "))
+}
+
+//是否配置了调用权限
+func (o *serverOptions) hasPermissions() bool {
+	if len(o.permissions) > 0 {
+		return true
+	}
+	for _, r := range o.receivers {
+		if len(r.Permissions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//调用方的app-id来自请求头，没有dapr-api-token校验时任何调用方都可以伪造
+func (o *serverOptions) checkCallerID() error {
+	if o.apiToken != "" {
+		return nil
+	}
+	if o.hasPermissions() {
+		return errors.New("permissions trust the caller app id, set an app api token with WithAppAPIToken")
+	}
+	if o.rateLimit != nil && len(o.rateLimit.Limits) > 0 {
+		return errors.New("rate limits trust the caller app id, set an app api token with WithAppAPIToken")
+	}
+	if o.admin != nil {
+		return errors.New("admin methods trust the caller app id, set an app api token with WithAppAPIToken")
+	}
+	return nil
+}
+
+//NewHTTPRouter 创建HTTP服务使用的路由，可以读取请求头中的metadata，并按Error输出HTTP状态码
+//外部通过dapr_http.NewServiceWithMux创建的服务无法设置依赖请求头的配置，需要时使用NewHTTPService
+func NewHTTPRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(withHeaders, withErrorStatus)
+	return router
+}
+
+//Service 获取底层的dapr服务，可以继续添加Topic等处理函数
+func (s *Server) Service() common.Service {
+	return s.svc
+}
+
+//Start 启动服务
+func (s *Server) Start() error {
+	return s.svc.Start()
+}
+
+//Stop 停止服务
+func (s *Server) Stop() error {
+	return s.svc.Stop()
+}
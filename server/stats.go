@@ -0,0 +1,45 @@
+package dapr_sdk_warpper
+
+import (
+	"sync"
+)
+
+//MethodStats 函数的调用统计
+type MethodStats struct {
+	Calls          uint64 `json:"calls" yaml:"calls"`
+	Errors         uint64 `json:"errors" yaml:"errors"`
+	Panics         uint64 `json:"panics" yaml:"panics"`
+	Timeouts       uint64 `json:"timeouts" yaml:"timeouts"`
+	Rejected       uint64 `json:"rejected" yaml:"rejected"`               //超过并发限制被拒绝的调用
+	InFlight       int64  `json:"in_flight" yaml:"in_flight"`             //正在执行的调用
+	RateLimited    uint64 `json:"rate_limited" yaml:"rate_limited"`       //超过调用方的限流被拒绝的调用
+	Denied         uint64 `json:"denied" yaml:"denied"`                   //调用方没有权限被拒绝的调用
+	InvalidReplies uint64 `json:"invalid_replies" yaml:"invalid_replies"` //出参没有通过校验的调用，只在开启WithReplyValidation时统计
+}
+
+//按路由统计，函数的实现被替换后继续累计
+type methodStats struct {
+	sync.Mutex // protects counters
+	stats      MethodStats
+}
+
+func (s *methodStats) update(fn func(stats *MethodStats)) {
+	s.Lock()
+	fn(&s.stats)
+	s.Unlock()
+}
+
+//记录一次被拒绝的调用，fn增加对应原因的计数
+func (s *methodStats) reject(fn func(stats *MethodStats)) {
+	s.update(func(stats *MethodStats) {
+		stats.Calls++
+		stats.Errors++
+		fn(stats)
+	})
+}
+
+func (s *methodStats) snapshot() MethodStats {
+	s.Lock()
+	defer s.Unlock()
+	return s.stats
+}
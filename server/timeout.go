@@ -0,0 +1,53 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"time"
+)
+
+//调用方指定超时时间的metadata或者查询参数，格式如"500ms"
+const timeoutKey = "timeout"
+
+//MethodTimeouter 函数组实现此接口后，可以为个别函数指定超时时间
+//返回值的key为Go的函数名，优先级高于WithTimeout，低于WithMethodTimeout
+type MethodTimeouter interface {
+	MethodTimeouts() map[string]time.Duration
+}
+
+//函数的超时时间，0表示不限制
+func (server *daprServer) methodTimeout(rcvr interface{}, m *methodType) time.Duration {
+	if timeout, ok := server.timeouts[m.route]; ok {
+		return timeout
+	}
+	if timeouter, ok := rcvr.(MethodTimeouter); ok {
+		if timeout, ok := timeouter.MethodTimeouts()[m.method.Name]; ok {
+			return timeout
+		}
+	}
+	return server.timeout
+}
+
+//调用方要求的超时时间，查询参数优先于metadata
+func callerTimeout(ctx context.Context, info *InvocationInfo) time.Duration {
+	val := info.Query.Get(timeoutKey)
+	if val == "" {
+		val = incomingMetadata(ctx, timeoutKey)
+	}
+	timeout, err := time.ParseDuration(val)
+	if err != nil || timeout <= 0 {
+		return 0
+	}
+	return timeout
+}
+
+//按函数的超时时间与调用方的要求设置ctx的deadline，较短的生效
+func (server *daprServer) withTimeout(ctx context.Context, entry *methodEntry, info *InvocationInfo) (context.Context, context.CancelFunc) {
+	timeout := entry.timeout
+	if caller := callerTimeout(ctx, info); caller > 0 && (timeout <= 0 || caller < timeout) {
+		timeout = caller
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
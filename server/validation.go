@@ -0,0 +1,168 @@
+package dapr_sdk_warpper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	validator "github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	zh_translations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+//调用方指定校验错误语言的metadata，格式与HTTP的Accept-Language一致
+const languageKey = "accept-language"
+
+//FieldError 一个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`           //字段的json名称，嵌套的字段以.连接
+	Rule    string `json:"rule"`            //未通过的校验规则，如required
+	Param   string `json:"param,omitempty"` //校验规则的参数，如max=3中的3
+	Message string `json:"message"`         //按调用方的语言翻译的错误信息
+}
+
+//使用json标签作为字段名，校验错误中的字段名与调用方看到的一致
+func jsonFieldName(fld reflect.StructField) string {
+	name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+//为Validator注册中文与英文的错误信息，默认使用英文
+func newTranslator(v *validator.Validate) (*ut.UniversalTranslator, error) {
+	v.RegisterTagNameFunc(jsonFieldName)
+	enLocale := en.New()
+	uni := ut.New(enLocale, enLocale, zh.New())
+	enTrans, _ := uni.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		return nil, err
+	}
+	zhTrans, _ := uni.GetTranslator("zh")
+	if err := zh_translations.RegisterDefaultTranslations(v, zhTrans); err != nil {
+		return nil, err
+	}
+	return uni, nil
+}
+
+//按Accept-Language的顺序选择翻译，如"zh-CN,zh;q=0.9,en;q=0.8"
+func (server *daprServer) translator(ctx context.Context) ut.Translator {
+	var locales []string
+	for _, lang := range strings.Split(incomingMetadata(ctx, languageKey), ",") {
+		lang = strings.ToLower(strings.TrimSpace(strings.SplitN(lang, ";", 2)[0]))
+		if idx := strings.IndexAny(lang, "-_"); idx >= 0 {
+			lang = lang[:idx]
+		}
+		if lang != "" {
+			locales = append(locales, lang)
+		}
+	}
+	trans, _ := server.translators.FindTranslator(locales...)
+	return trans
+}
+
+//将校验错误转换为按字段列出的InvalidArgument错误
+func (server *daprServer) validationError(ctx context.Context, err error) error {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+	trans := server.translator(ctx)
+	fields := make([]FieldError, 0, len(validationErrs))
+	messages := make([]string, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		field := fe.Namespace()
+		//去掉入参的类型名
+		if idx := strings.Index(field, "."); idx >= 0 {
+			field = field[idx+1:]
+		}
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fe.Translate(trans),
+		})
+		messages = append(messages, fe.Translate(trans))
+	}
+	e := InvalidArgument("%s", strings.Join(messages, "; "))
+	e.Fields = fields
+	e.cause = err
+	return e
+}
+
+//校验函数的出参，开发模式下返回内部错误，否则只记录日志与统计
+func (server *daprServer) validateReply(route string, entry *methodEntry, reply interface{}) error {
+	if !server.checkReply {
+		return nil
+	}
+	err := server.validParam(reflect.ValueOf(reply))
+	if err == nil {
+		return nil
+	}
+	if server.dev {
+		e := Internal("%s: invalid reply: %v", route, err)
+		e.cause = err
+		return e
+	}
+	server.logger.Printf("warning: [%s] returns invalid reply: %v", route, err)
+	entry.stats.update(func(stats *MethodStats) { stats.InvalidReplies++ })
+	return nil
+}
+
+//Validatable 入参实现此接口后，在标签校验通过后调用，用于标签无法表达的校验
+//返回的错误不是*Error时转换为InvalidArgument错误
+type Validatable interface {
+	Validate(ctx context.Context) error
+}
+
+//调用入参的Validate
+func validateInput(ctx context.Context, in interface{}) error {
+	v, ok := in.(Validatable)
+	if !ok {
+		return nil
+	}
+	err := v.Validate(ctx)
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	e = InvalidArgument("%s", err.Error())
+	e.cause = err
+	return e
+}
+
+//在服务的Validator上注册自定义的校验
+type validation func(v *validator.Validate, uni *ut.UniversalTranslator) error
+
+//注册校验错误的翻译，messages的key为语言，如"zh"、"en"，{0}为字段名，{1}为校验规则的参数
+func registerMessages(v *validator.Validate, uni *ut.UniversalTranslator, tag string, messages map[string]string) error {
+	for locale, message := range messages {
+		trans, found := uni.GetTranslator(locale)
+		if !found {
+			return fmt.Errorf("validation %s: unsupported locale %s", tag, locale)
+		}
+		message := message
+		err := v.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+			return trans.Add(tag, message, true)
+		}, func(trans ut.Translator, fe validator.FieldError) string {
+			msg, err := trans.T(tag, fe.Field(), fe.Param())
+			if err != nil {
+				return fe.Error()
+			}
+			return msg
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}